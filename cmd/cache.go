@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hiroki-abe-58/imgai/pkg/cache"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cacheDir     string
+	cacheMaxSize byteSize
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Inspect and manage the processing cache",
+	Long: `Inspect and manage the on-disk cache used by --cache and "imgai serve --cache".
+
+The cache keeps records of produced outputs and copies of encoded images,
+keyed by the source content and the normalized options. Copies are evicted
+least recently used first once the cache exceeds its maximum size.
+
+Examples:
+  imgai cache stats
+  imgai cache prune --max-size 500MB
+  imgai cache clear --dir /var/cache/imgai`,
+}
+
+var cacheStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show the size and contents of the cache",
+	Args:  cobra.NoArgs,
+	RunE:  runCacheStats,
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Evict least recently used images until the cache fits --max-size",
+	Args:  cobra.NoArgs,
+	RunE:  runCachePrune,
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove everything from the cache",
+	Args:  cobra.NoArgs,
+	RunE:  runCacheClear,
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheStatsCmd, cachePruneCmd, cacheClearCmd)
+
+	cacheCmd.PersistentFlags().StringVar(&cacheDir, "dir", cache.DefaultDir, "Cache directory")
+	cacheMaxSize = cache.DefaultMaxSize
+	cachePruneCmd.Flags().Var(&cacheMaxSize, "max-size", "Size to shrink stored images to, e.g. 500MB")
+}
+
+func runCacheStats(cmd *cobra.Command, args []string) error {
+	store, err := openCacheDir()
+	if err != nil {
+		return err
+	}
+	stats, err := store.Stats()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("📦 Cache: %s\n", cacheDir)
+	fmt.Printf("   Records: %d\n", stats.Entries)
+	fmt.Printf("   Images:  %d (%s)\n", stats.Variants, formatBytes(stats.Bytes))
+	if stats.Variants > 0 {
+		fmt.Printf("   Oldest:  %s\n", stats.Oldest.Format(time.DateTime))
+		fmt.Printf("   Newest:  %s\n", stats.Newest.Format(time.DateTime))
+	}
+	return nil
+}
+
+func runCachePrune(cmd *cobra.Command, args []string) error {
+	store, err := openCacheDir()
+	if err != nil {
+		return err
+	}
+	freed, err := store.Prune(int64(cacheMaxSize))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✓ Freed %s from %s\n", formatBytes(freed), cacheDir)
+	return nil
+}
+
+func runCacheClear(cmd *cobra.Command, args []string) error {
+	store, err := openCacheDir()
+	if err != nil {
+		return err
+	}
+	if err := store.Clear(); err != nil {
+		return err
+	}
+	fmt.Printf("✓ Cleared %s\n", cacheDir)
+	return nil
+}
+
+// openCacheDir opens the --dir cache, which must already exist and be
+// marked as a cache
+func openCacheDir() (*cache.Store, error) {
+	if info, err := os.Stat(cacheDir); err != nil {
+		return nil, usageError(err)
+	} else if !info.IsDir() {
+		return nil, usageError(fmt.Errorf("%s is not a directory", cacheDir))
+	}
+	store, err := cache.OpenExisting(cacheDir)
+	if errors.Is(err, cache.ErrNotCache) {
+		return nil, usageError(err)
+	}
+	return store, err
+}
+
+// formatBytes formats n with a binary unit, e.g. 1.5 MB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
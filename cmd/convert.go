@@ -1,47 +1,96 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io"
 
 	"github.com/hiroki-abe-58/imgai/pkg/batch"
 	"github.com/hiroki-abe-58/imgai/pkg/image"
+	"github.com/hiroki-abe-58/imgai/pkg/storage"
 	"github.com/spf13/cobra"
 )
 
 var (
 	convertFormat  string
 	convertQuality int
+	convertTIFF    string
+	convertColors  int
+	convertPalette string
+	convertDither  string
 	convertOutput  string
 	convertWorkers int
 	convertDryRun  bool
+	convertBatch   batchFlags
 )
 
 var convertCmd = &cobra.Command{
 	Use:   "convert [image(s)]",
 	Short: "Convert one or multiple images to a different format",
-	Long: `Convert one or multiple images to a different format (JPEG, PNG, WebP).
+	Long: `Convert one or multiple images to a different format (JPEG, PNG, GIF, BMP, TIFF).
+
+GIF output uses an adaptive palette of --gif-colors colors picked from each
+image, or a fixed --gif-palette, with Floyd-Steinberg dithering unless
+--gif-dither none. TIFF output is deflate-compressed unless --tiff-compression none.
 
 Examples:
   imgai convert photo.jpg --format png
+  imgai convert logo.png --format gif --gif-colors 64 --gif-dither none
+  imgai convert scan.png --format tiff --tiff-compression none
   imgai convert *.jpg --format png --dry-run
-  imgai convert *.jpg --format png --workers 8`,
-	Args: cobra.MinimumNArgs(1),
+  imgai convert *.jpg --format png --workers 8
+  imgai convert - --format png -o - < photo.jpg > photo.png`,
+	Args: convertBatch.inputArgs,
 	RunE: runConvert,
 }
 
 func init() {
 	rootCmd.AddCommand(convertCmd)
 
-	convertCmd.Flags().StringVarP(&convertFormat, "format", "f", "", "Target format (jpg, png, webp) [required]")
+	convertCmd.Flags().StringVarP(&convertFormat, "format", "f", "", "Target format (jpg, png, gif, bmp, tiff) [required]")
 	convertCmd.Flags().IntVarP(&convertQuality, "quality", "q", 90, "JPEG quality (1-100)")
-	convertCmd.Flags().StringVarP(&convertOutput, "output", "o", "", "Output file path (single file only)")
+	convertCmd.Flags().StringVar(&convertTIFF, "tiff-compression", "deflate", "TIFF compression: deflate or none")
+	convertCmd.Flags().IntVar(&convertColors, "gif-colors", 256, "Number of colors in the adaptive GIF palette (2-256)")
+	convertCmd.Flags().StringVar(&convertPalette, "gif-palette", "adaptive", "GIF palette: adaptive, plan9 or websafe")
+	convertCmd.Flags().StringVar(&convertDither, "gif-dither", "floyd-steinberg", "GIF dithering: floyd-steinberg or none")
+	convertCmd.Flags().StringVarP(&convertOutput, "output", "o", "", "Output file path, or - for stdout (single file only)")
 	convertCmd.Flags().IntVar(&convertWorkers, "workers", 4, "Number of parallel workers")
 	convertCmd.Flags().BoolVar(&convertDryRun, "dry-run", false, "Preview operations without executing")
+	convertBatch.register(convertCmd)
 	
 	convertCmd.MarkFlagRequired("format")
 }
 
 func runConvert(cmd *cobra.Command, args []string) error {
+	if err := validateConvertFlags(); err != nil {
+		return usageError(err)
+	}
+	if err := convertBatch.setup(args); err != nil {
+		return usageError(err)
+	}
+	if err := checkStdio(args, convertOutput, &convertBatch); err != nil {
+		return usageError(err)
+	}
+	if err := convertBatch.checkOutDir(args, convertOutput); err != nil {
+		return usageError(err)
+	}
+
+	// Dry-run mode
+	if convertDryRun {
+		return runConvertDryRun(cmd.Context(), args)
+	}
+
+	// Single file mode with output path
+	if len(args) == 1 && convertOutput != "" {
+		return runConvertSingle(cmd.Context(), args[0])
+	}
+
+	// Batch processing mode
+	return runConvertBatch(cmd.Context(), args)
+}
+
+// validateConvertFlags normalizes and validates the target format and quality
+func validateConvertFlags() error {
 	// Validate format
 	convertFormat = image.NormalizeFormat(convertFormat)
 	if err := image.ValidateFormat(convertFormat); err != nil {
@@ -55,70 +104,153 @@ func runConvert(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// Dry-run mode
-	if convertDryRun {
-		return runConvertDryRun(args)
-	}
-
-	// Single file mode with output path
-	if len(args) == 1 && convertOutput != "" {
-		return runConvertSingle(args[0])
-	}
-
-	// Batch processing mode
-	return runConvertBatch(args)
+	// Validate TIFF and GIF settings
+	return image.ValidateEncodeOptions(image.EncodeOptions{
+		TIFFCompression: convertTIFF,
+		GIFColors:       convertColors,
+		GIFPalette:      convertPalette,
+		GIFDither:       convertDither,
+	})
 }
 
-func runConvertDryRun(args []string) error {
+func runConvertDryRun(ctx context.Context, args []string) error {
 	printDryRunHeader()
 	
 	processor := batch.NewProcessor(convertWorkers)
 	processor.SetProgressBar(false)
 	
-	previewFunc := func(path string) error {
+	previewFunc := func(ctx context.Context, path string) (string, error) {
 		outputPath := convertOutput
 		if outputPath == "" {
 			ext := image.GetFileExtension(convertFormat)
 			outputPath = fmt.Sprintf("%s (auto-generated %s)", path, ext)
 		}
-		qualityInfo := ""
-		if convertFormat == "jpg" {
-			qualityInfo = fmt.Sprintf(", quality=%d", convertQuality)
-		}
-		fmt.Printf("  Would convert: %s → %s (%s%s)\n", path, outputPath, convertFormat, qualityInfo)
-		return nil
+		return outputPath, nil
 	}
+
+	qualityInfo := ""
+	switch convertFormat {
+	case "jpg":
+		qualityInfo = fmt.Sprintf(", quality=%d", convertQuality)
+	case "tiff":
+		qualityInfo = fmt.Sprintf(", compression=%s", convertTIFF)
+	case "gif":
+		qualityInfo = fmt.Sprintf(", palette=%s, colors=%d, dither=%s", convertPalette, convertColors, convertDither)
+	}
+	processor.SetResultHandler(func(result batch.Result) {
+		fmt.Fprintf(console, "  Would convert: %s → %s (%s%s)\n", result.Path, result.Output, convertFormat, qualityInfo)
+	})
 	
-	results := processor.Process(args, previewFunc)
+	results := convertBatch.process(ctx, processor, args, previewFunc)
 	printDryRunFooter(len(results))
 	return nil
 }
 
-func runConvertSingle(inputPath string) error {
-	if err := image.ValidateInputFile(inputPath); err != nil {
+func runConvertSingle(ctx context.Context, inputPath string) error {
+	opts := image.ConvertOptions{
+		Format:  convertFormat,
+		Quality: convertQuality,
+		Output:  convertOutput,
+		Limits:  convertBatch.limits(),
+	}
+	setConvertEncoding(&opts)
+	if isStream(inputPath, convertOutput) {
+		// The target format always comes from --format
+		stream := func(ctx context.Context, r io.Reader, w io.Writer, _ string) (image.Result, error) {
+			return image.ConvertStream(ctx, r, w, opts)
+		}
+		return convertBatch.runSingle(ctx, "convert", inputPath, newStreamFunc(convertOutput, stream), printConverted)
+	}
+
+	if !storage.IsRemote(inputPath) {
+		if err := image.ValidateInputFile(nil, inputPath); err != nil {
+			return failureError(err)
+		}
+	}
+	return convertBatch.runSingle(ctx, "convert", inputPath, newConvertFunc(opts), printConverted)
+}
+
+func runConvertBatch(ctx context.Context, args []string) error {
+	processor, cleanup, err := convertBatch.newProcessor(convertWorkers)
+	if err != nil {
 		return err
 	}
+	defer cleanup()
 
 	opts := image.ConvertOptions{
 		Format:  convertFormat,
 		Quality: convertQuality,
-		Output:  convertOutput,
+		Output:  "",
+		Limits:  convertBatch.limits(),
+	}
+	setConvertEncoding(&opts)
+	if err := convertBatch.setOperation(processor, "convert", opts); err != nil {
+		return err
 	}
-	return image.ConvertImage(inputPath, opts)
+
+	processor.SetResultHandler(printConverted)
+	memOpts := opts
+	if convertBatch.archives != nil {
+		memOpts.FS, memOpts.Out = convertBatch.archives.FS(), convertBatch.archives.FS()
+	}
+	results := convertBatch.process(ctx, processor, args, convertBatch.wrap(newConvertFunc(opts), newConvertFunc(memOpts)))
+	if err := convertBatch.writeArchive(ctx); err != nil {
+		return err
+	}
+	if err := convertBatch.writeReport("convert", results); err != nil {
+		return err
+	}
+	return printResults(results)
 }
 
-func runConvertBatch(args []string) error {
-	processor := batch.NewProcessor(convertWorkers)
-	
-	processFunc := func(path string) error {
-		opts := image.ConvertOptions{
-			Format:  convertFormat,
-			Quality: convertQuality,
-			Output:  "",
-		}
-		return image.ConvertImage(path, opts)
+// prepareConvertWatch validates the convert flags parsed for watch and
+// returns the ProcessFunc to run on changed files
+func prepareConvertWatch(processor *batch.Processor) (batch.ProcessFunc, func(), error) {
+	if convertFormat == "" {
+		return nil, nil, usageError(fmt.Errorf("required flag \"format\" not set"))
+	}
+	if err := validateConvertFlags(); err != nil {
+		return nil, nil, usageError(err)
 	}
 
-	results := processor.Process(args, processFunc)
-	return printResults(results)
+	opts := image.ConvertOptions{
+		Format:  convertFormat,
+		Quality: convertQuality,
+		Output:  "",
+		Limits:  convertBatch.limits(),
+	}
+	setConvertEncoding(&opts)
+	if err := convertBatch.setOperation(processor, "convert", opts); err != nil {
+		return nil, nil, err
+	}
+	return newConvertFunc(opts), func() {}, nil
+}
+
+// setConvertEncoding copies the TIFF and GIF settings for the target format
+// into opts. Settings for other formats are left empty so that they do not
+// change cache keys.
+func setConvertEncoding(opts *image.ConvertOptions) {
+	switch opts.Format {
+	case "tiff":
+		opts.TIFFCompression = convertTIFF
+	case "gif":
+		opts.GIFColors = convertColors
+		opts.GIFPalette = convertPalette
+		opts.GIFDither = convertDither
+	}
+}
+
+// newConvertFunc returns a ProcessFunc that converts a file with opts
+func newConvertFunc(opts image.ConvertOptions) batch.ProcessFunc {
+	return func(ctx context.Context, path string) (string, error) {
+		result, err := image.ConvertImage(ctx, path, opts)
+		return result.Path, err
+	}
+}
+
+// printConverted prints a line for a successfully converted file
+func printConverted(result batch.Result) {
+	if result.Success && !result.Skipped {
+		fmt.Fprintf(console, "✓ Converted: %s → %s (%s)\n", result.Path, result.Output, convertFormat)
+	}
 }
@@ -31,12 +31,12 @@ func runExif(cmd *cobra.Command, args []string) error {
 	inputPath := args[0]
 
 	// Validate input file
-	if err := image.ValidateInputFile(inputPath); err != nil {
+	if err := image.ValidateInputFile(nil, inputPath); err != nil {
 		return err
 	}
 
 	// Read EXIF data
-	data, err := metadata.ReadExif(inputPath)
+	data, err := metadata.ReadExif(nil, inputPath)
 	if err != nil {
 		return fmt.Errorf("failed to read EXIF data: %w", err)
 	}
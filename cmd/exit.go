@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+)
+
+// Process exit codes
+const (
+	ExitOK             = 0
+	ExitError          = 1
+	ExitUsage          = 2
+	ExitPartialFailure = 3
+	ExitTotalFailure   = 4
+	ExitInterrupted    = 130
+)
+
+// exitError attaches a process exit code to an error
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// usageError marks err as caused by invalid arguments or flags
+func usageError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code: ExitUsage, err: err}
+}
+
+// failureError marks err as a processing failure, distinguishing
+// interrupted runs from failed ones
+func failureError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, context.Canceled) {
+		return &exitError{code: ExitInterrupted, err: err}
+	}
+	return &exitError{code: ExitTotalFailure, err: err}
+}
+
+// exitCode returns the process exit code for err
+func exitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	return ExitError
+}
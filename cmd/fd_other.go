@@ -0,0 +1,9 @@
+//go:build !unix
+
+package cmd
+
+// checkFD accepts any file descriptor; writes to one that is not open fail
+// when events are emitted
+func checkFD(fd int) error {
+	return nil
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package cmd
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// checkFD returns an error if fd is not an open file descriptor
+func checkFD(fd int) error {
+	if _, err := unix.FcntlInt(uintptr(fd), unix.F_GETFD, 0); err != nil {
+		return fmt.Errorf("file descriptor %d is not open: %w", fd, err)
+	}
+	return nil
+}
@@ -0,0 +1,459 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hiroki-abe-58/imgai/pkg/archive"
+	"github.com/hiroki-abe-58/imgai/pkg/batch"
+	"github.com/hiroki-abe-58/imgai/pkg/cache"
+	"github.com/hiroki-abe-58/imgai/pkg/image"
+	"github.com/hiroki-abe-58/imgai/pkg/remote"
+	"github.com/hiroki-abe-58/imgai/pkg/report"
+	"github.com/spf13/cobra"
+)
+
+// batchFlags holds flags shared by all batch processing commands
+type batchFlags struct {
+	journal   string
+	resume    bool
+	cache     string
+	cacheSize byteSize
+	timeout   time.Duration
+	maxMemory byteSize
+
+	maxPixels   int64
+	maxFileSize byteSize
+	maxWidth    int
+	maxHeight   int
+
+	report     string
+	reportFile string
+	collector  *report.Collector
+
+	progress   string
+	progressFD int
+
+	failFast     bool
+	maxFailures  int
+	retries      int
+	retryBackoff time.Duration
+
+	filesFrom string
+	null      bool
+	files     []string
+
+	fetchTimeout     time.Duration
+	fetchConcurrency int
+	fetcher          *remote.Fetcher
+
+	outDir     string
+	outArchive string
+	overwrite  bool
+	archives   *archive.Reader
+	archiveOut *archive.Writer
+
+	maxArchiveSize   byteSize
+	maxArchiveImages int
+
+	// roots and published place staged outputs; see outputName and claim
+	roots     map[string]string
+	published map[string]string
+	mu        sync.Mutex
+
+	// images holds the image.Result of each input until it is reported;
+	// see describing
+	images sync.Map
+}
+
+// register adds the shared batch flags to a command
+func (f *batchFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.filesFrom, "files-from", "", "Read input paths from this file, one per line (- for stdin)")
+	cmd.Flags().BoolVarP(&f.null, "null", "0", false, "Input paths in --files-from are NUL-separated (find -print0)")
+	cmd.Flags().StringVar(&f.outDir, "out-dir", "", "Write outputs to this directory or s3://bucket/prefix/ and leave inputs unchanged")
+	cmd.Flags().StringVar(&f.outArchive, "out-archive", "", "Write all outputs into this .zip, .tar or .tar.gz archive and leave inputs unchanged")
+	f.maxArchiveSize = byteSize(archive.DefaultLimits.MaxTotalSize)
+	cmd.Flags().Var(&f.maxArchiveSize, "max-archive-size", "Reject archive inputs whose images total more than this (0 means unlimited)")
+	cmd.Flags().IntVar(&f.maxArchiveImages, "max-archive-images", archive.DefaultLimits.MaxMembers, "Reject archive inputs with more images than this (0 means unlimited)")
+	cmd.Flags().BoolVar(&f.overwrite, "overwrite", false, "Replace existing files in the current directory with outputs of remote inputs")
+	cmd.Flags().DurationVar(&f.fetchTimeout, "fetch-timeout", remote.DefaultTimeout, "Maximum time to download each http(s) input")
+	cmd.Flags().IntVar(&f.fetchConcurrency, "fetch-concurrency", remote.DefaultConcurrency, "Number of http(s) inputs downloaded at once")
+	cmd.Flags().StringVar(&f.journal, "journal", "", "Record completed files to this checkpoint journal (JSON lines)")
+	cmd.Flags().BoolVar(&f.resume, "resume", false, "Skip files already completed in --journal with the same options and unchanged since")
+	cmd.Flags().DurationVar(&f.timeout, "timeout", 0, "Maximum time per file, e.g. 30s (0 means no limit)")
+	cmd.Flags().Var(&f.maxMemory, "max-memory", "Memory budget for images decoded at once, e.g. 2GB (0 means unlimited)")
+	f.registerLimits(cmd)
+	cmd.Flags().BoolVar(&f.failFast, "fail-fast", false, "Stop starting new files after the first failure")
+	cmd.Flags().IntVar(&f.maxFailures, "max-failures", 0, "Stop starting new files after this many failures (0 means never)")
+	cmd.Flags().IntVar(&f.retries, "retries", 0, "Retry transient I/O errors this many times")
+	cmd.Flags().DurationVar(&f.retryBackoff, "retry-backoff", 200*time.Millisecond, "Initial delay between retries, doubled after each attempt")
+	cmd.Flags().StringVar(&f.progress, "progress", "bar", "Progress output: bar, ndjson or none")
+	cmd.Flags().IntVar(&f.progressFD, "progress-fd", 2, "File descriptor for --progress=ndjson events (default stderr)")
+	cmd.Flags().StringVar(&f.report, "report", "", "Write a machine-readable report (json, csv)")
+	cmd.Flags().StringVar(&f.reportFile, "report-file", "-", "Report destination file (- for stdout)")
+	cmd.Flags().StringVar(&f.cache, "cache", "", "Skip unchanged inputs using a processing cache in this directory (e.g. "+cache.DefaultDir+")")
+	f.cacheSize = cache.DefaultMaxSize
+	cmd.Flags().Var(&f.cacheSize, "cache-max-size", "Keep copies of outputs in --cache up to this size to restore deleted outputs (0 disables)")
+}
+
+// registerLimits adds the input limit flags to a command
+func (f *batchFlags) registerLimits(cmd *cobra.Command) {
+	cmd.Flags().Int64Var(&f.maxPixels, "max-pixels", 0, "Reject inputs with more pixels than this (0 means unlimited)")
+	cmd.Flags().Var(&f.maxFileSize, "max-file-size", "Reject input files larger than this, e.g. 50MB (0 means unlimited)")
+	cmd.Flags().IntVar(&f.maxWidth, "max-width", 0, "Reject inputs wider than this many pixels (0 means unlimited)")
+	cmd.Flags().IntVar(&f.maxHeight, "max-height", 0, "Reject inputs taller than this many pixels (0 means unlimited)")
+}
+
+// checkLimits rejects negative input limits
+func (f *batchFlags) checkLimits() error {
+	if f.maxPixels < 0 || f.maxWidth < 0 || f.maxHeight < 0 {
+		return fmt.Errorf("resource limits must not be negative")
+	}
+	return nil
+}
+
+// inputArgs requires at least one positional input unless --files-from is set
+func (f *batchFlags) inputArgs(cmd *cobra.Command, args []string) error {
+	if f.filesFrom != "" {
+		return nil
+	}
+	return cobra.MinimumNArgs(1)(cmd, args)
+}
+
+// setup validates the shared batch flags, reads the --files-from list and
+// prepares reporting
+func (f *batchFlags) setup(args []string) error {
+	if f.null && f.filesFrom == "" {
+		return fmt.Errorf("--null requires --files-from")
+	}
+	if f.filesFrom != "" {
+		if len(args) > 0 {
+			return fmt.Errorf("--files-from cannot be combined with input arguments")
+		}
+		if err := f.readFileList(); err != nil {
+			return err
+		}
+	}
+	if f.resume && f.journal == "" {
+		return fmt.Errorf("--resume requires --journal")
+	}
+	if err := f.checkLimits(); err != nil {
+		return err
+	}
+	if f.maxArchiveSize < 0 || f.maxArchiveImages < 0 {
+		return fmt.Errorf("--max-archive-size and --max-archive-images must not be negative")
+	}
+	if f.maxFailures < 0 || f.retries < 0 {
+		return fmt.Errorf("--max-failures and --retries must not be negative")
+	}
+	if f.fetchTimeout <= 0 || f.fetchConcurrency <= 0 {
+		return fmt.Errorf("--fetch-timeout and --fetch-concurrency must be positive")
+	}
+	f.fetcher = remote.NewFetcher(remote.Config{
+		MaxSize:     int64(f.maxFileSize),
+		Timeout:     f.fetchTimeout,
+		Concurrency: f.fetchConcurrency,
+	})
+	if err := f.setupArchives(args); err != nil {
+		return err
+	}
+	f.roots = inputRoots(f.inputs(args))
+	switch f.progress {
+	case "bar", "ndjson", "none":
+	default:
+		return fmt.Errorf("unsupported progress mode: %s (supported: bar, ndjson, none)", f.progress)
+	}
+	if f.progress == "ndjson" {
+		if f.progressFD < 0 {
+			return fmt.Errorf("invalid --progress-fd: %d", f.progressFD)
+		}
+		if err := checkFD(f.progressFD); err != nil {
+			return fmt.Errorf("invalid --progress-fd: %w", err)
+		}
+	}
+	if f.report != "" {
+		if err := report.ValidateFormat(f.report); err != nil {
+			return err
+		}
+		f.collector = report.NewCollector()
+	}
+	f.routeConsole()
+	return nil
+}
+
+// routeConsole keeps the report and the progress events free of human-
+// readable text, which goes to whichever of stdout and stderr carries
+// neither of them, or nowhere when both are taken
+func (f *batchFlags) routeConsole() {
+	reportStdout := f.report != "" && f.reportFile == "-"
+	events := -1
+	if f.progress == "ndjson" {
+		events = f.progressFD
+	}
+	switch {
+	case reportStdout && events == 2:
+		console, errConsole = io.Discard, io.Discard
+	case reportStdout || events == 1:
+		console = os.Stderr
+	case events == 2:
+		errConsole = os.Stdout
+	}
+}
+
+// readFileList loads the input paths named by --files-from
+func (f *batchFlags) readFileList() error {
+	r := io.Reader(os.Stdin)
+	if f.filesFrom != "-" {
+		file, err := os.Open(f.filesFrom)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	files, err := batch.ReadFileList(r, f.null)
+	if err != nil {
+		return fmt.Errorf("failed to read --files-from: %w", err)
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no input files listed in %s", f.filesFrom)
+	}
+	f.files = files
+	return nil
+}
+
+// inputs returns the --files-from list when set, or args otherwise
+func (f *batchFlags) inputs(args []string) []string {
+	if f.files != nil {
+		return f.files
+	}
+	return args
+}
+
+// process runs processFunc over the --files-from list when set, or over the
+// files matching args otherwise. Archive inputs expand to their images.
+func (f *batchFlags) process(ctx context.Context, processor *batch.Processor, args []string, processFunc batch.ProcessFunc) []batch.Result {
+	if f.archives != nil {
+		processor.SetArchives(f.archives)
+	}
+	if f.files != nil {
+		return processor.ProcessFiles(ctx, f.files, processFunc)
+	}
+	return processor.Process(ctx, args, processFunc)
+}
+
+// limits returns the decode limits configured by the shared flags
+func (f *batchFlags) limits() image.Limits {
+	return image.Limits{
+		MaxPixels:   f.maxPixels,
+		MaxFileSize: int64(f.maxFileSize),
+		MaxWidth:    f.maxWidth,
+		MaxHeight:   f.maxHeight,
+	}
+}
+
+// runSingle processes one file outside the batch processor, applying the
+// per-file timeout, passing the result to onResult and writing a report
+// when requested
+func (f *batchFlags) runSingle(ctx context.Context, command, path string, processFunc batch.ProcessFunc, onResult func(batch.Result)) error {
+	if f.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	output, err := f.wrap(processFunc, nil)(ctx, path)
+	result := batch.Result{
+		Path:     path,
+		Output:   output,
+		Success:  err == nil,
+		Error:    err,
+		Duration: time.Since(start),
+	}
+	onResult(result)
+
+	if rerr := f.writeReport(command, []batch.Result{result}); rerr != nil && err == nil {
+		return rerr
+	}
+	return failureError(err)
+}
+
+// wrap lets local take remote inputs, --out-dir and --out-archive, hands
+// archive members to inMemory as described by stage, and instruments the
+// result for reporting when --report is set
+func (f *batchFlags) wrap(local, inMemory batch.ProcessFunc) batch.ProcessFunc {
+	processFunc := f.describing(f.stage(local, inMemory))
+	if f.collector == nil {
+		return processFunc
+	}
+	return f.collector.Wrap(processFunc)
+}
+
+// imageKey is the context key of the *image.Result a ProcessFunc fills in
+// with describe
+type imageKey struct{}
+
+// describe records result as the image written for the input processed
+// with ctx, so that it can be reported without reading the output back
+func describe(ctx context.Context, result image.Result) {
+	if slot, ok := ctx.Value(imageKey{}).(*image.Result); ok {
+		*slot = result
+	}
+}
+
+// describing returns a ProcessFunc that keeps the image.Result processFunc
+// describes for each input until described is called for it
+func (f *batchFlags) describing(processFunc batch.ProcessFunc) batch.ProcessFunc {
+	return func(ctx context.Context, path string) (string, error) {
+		var result image.Result
+		output, err := processFunc(context.WithValue(ctx, imageKey{}, &result), path)
+		if err == nil && result.Format != "" {
+			f.images.Store(path, result)
+		}
+		return output, err
+	}
+}
+
+// described returns and forgets the image.Result described for input
+func (f *batchFlags) described(input string) (image.Result, bool) {
+	result, ok := f.images.LoadAndDelete(input)
+	if !ok {
+		return image.Result{}, false
+	}
+	return result.(image.Result), true
+}
+
+// writeReport writes the --report for results, if requested
+func (f *batchFlags) writeReport(command string, results []batch.Result) error {
+	if f.collector == nil {
+		return nil
+	}
+	summary := report.Summarize(command, f.collector.Records(results))
+
+	if f.reportFile == "-" {
+		return report.Write(os.Stdout, f.report, summary)
+	}
+
+	file, err := os.Create(f.reportFile)
+	if err != nil {
+		return fmt.Errorf("failed to create report: %w", err)
+	}
+	if err := report.Write(file, f.report, summary); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return file.Close()
+}
+
+// newProcessor creates a batch processor configured from the shared flags.
+// The returned cleanup function must be called once processing is done.
+func (f *batchFlags) newProcessor(workers int) (*batch.Processor, func(), error) {
+	processor := batch.NewProcessor(workers)
+	processor.SetTimeout(f.timeout)
+	if f.progress != "bar" || (f.collector != nil && f.reportFile == "-") {
+		processor.SetProgressBar(false)
+	}
+	if f.progress == "ndjson" {
+		events := os.NewFile(uintptr(f.progressFD), "progress")
+		processor.SetEventHandler(batch.NewNDJSONHandler(events))
+	}
+	processor.SetMaxMemory(int64(f.maxMemory))
+	processor.SetRetry(f.retries, f.retryBackoff)
+	if f.failFast {
+		processor.SetMaxFailures(1)
+	} else {
+		processor.SetMaxFailures(f.maxFailures)
+	}
+	if f.journal == "" {
+		return processor, func() {}, nil
+	}
+
+	journal, err := batch.OpenJournal(f.journal, f.resume)
+	if err != nil {
+		return nil, nil, err
+	}
+	processor.SetJournal(journal)
+
+	cleanup := func() {
+		if err := journal.Close(); err != nil {
+			fmt.Fprintf(errConsole, "✗ Failed to close journal: %v\n", err)
+		}
+	}
+	return processor, cleanup, nil
+}
+
+// setOperation identifies op and options to processor for --resume and
+// attaches the processing cache when --cache is set
+func (f *batchFlags) setOperation(processor *batch.Processor, op string, options interface{}) error {
+	if err := processor.SetOperation(op, options); err != nil {
+		return err
+	}
+	if f.cache == "" {
+		return nil
+	}
+	store, err := cache.Open(f.cache)
+	if err != nil {
+		return err
+	}
+	store.SetMaxSize(int64(f.cacheSize))
+	processor.SetCache(store, op, options)
+	return nil
+}
+
+// byteSize is a flag value accepting sizes such as 512MB or 2GiB
+type byteSize int64
+
+// byteUnits maps size suffixes to multipliers (binary, case-insensitive)
+var byteUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"kib", 1 << 10}, {"mib", 1 << 20}, {"gib", 1 << 30}, {"tib", 1 << 40},
+	{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30}, {"tb", 1 << 40},
+	{"k", 1 << 10}, {"m", 1 << 20}, {"g", 1 << 30}, {"t", 1 << 40},
+	{"b", 1},
+}
+
+func (b *byteSize) String() string {
+	// Whole multiples print with their unit so defaults read as e.g. 1GB
+	for _, unit := range []struct {
+		suffix     string
+		multiplier int64
+	}{{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		if *b != 0 && int64(*b)%unit.multiplier == 0 {
+			return strconv.FormatInt(int64(*b)/unit.multiplier, 10) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(int64(*b), 10)
+}
+
+func (b *byteSize) Type() string {
+	return "size"
+}
+
+func (b *byteSize) Set(value string) error {
+	text := strings.ToLower(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(text, unit.suffix) {
+			text = strings.TrimSpace(strings.TrimSuffix(text, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(text, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q (use e.g. 512MB or 2GB)", value)
+	}
+	*b = byteSize(n * float64(multiplier))
+	return nil
+}
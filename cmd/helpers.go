@@ -1,40 +1,159 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 
+	"github.com/hiroki-abe-58/imgai/pkg/backup"
 	"github.com/hiroki-abe-58/imgai/pkg/batch"
+	"github.com/hiroki-abe-58/imgai/pkg/image"
+)
+
+// console receives human-readable progress and summaries, and errConsole
+// failures and warnings. They are redirected away from a machine-readable
+// report or progress events on stdout or stderr.
+var (
+	console    io.Writer = os.Stdout
+	errConsole io.Writer = os.Stderr
 )
 
 // printDryRunHeader prints the dry-run mode header
 func printDryRunHeader() {
-	fmt.Println("🔍 DRY RUN MODE - No files will be modified")
-	fmt.Println()
+	fmt.Fprintln(console, "🔍 DRY RUN MODE - No files will be modified")
+	fmt.Fprintln(console)
 }
 
 // printDryRunFooter prints the dry-run mode footer
 func printDryRunFooter(count int) {
-	fmt.Printf("\n✓ Would process %d images\n", count)
-	fmt.Println("💡 Run without --dry-run to execute")
+	fmt.Fprintf(console, "\n✓ Would process %d images\n", count)
+	fmt.Fprintln(console, "💡 Run without --dry-run to execute")
 }
 
-// printResults prints processing results summary
+// printResults prints processing results summary and returns an error
+// carrying the exit code for partial, total or interrupted failures
 func printResults(results []batch.Result) error {
 	successCount := 0
+	skippedCount := 0
+	canceledCount := 0
+	abortedCount := 0
 	for _, result := range results {
-		if result.Success {
+		switch {
+		case result.Success:
 			successCount++
-		} else {
-			fmt.Fprintf(os.Stderr, "✗ Failed: %s - %v\n", result.Path, result.Error)
+			if result.Skipped {
+				skippedCount++
+			}
+		case errors.Is(result.Error, context.Canceled):
+			canceledCount++
+		case errors.Is(result.Error, batch.ErrAborted):
+			abortedCount++
+		default:
+			fmt.Fprintf(errConsole, "✗ Failed: %s - %v\n", result.Path, result.Error)
+		}
+	}
+	failedCount := len(results) - successCount - canceledCount - abortedCount
+
+	fmt.Fprintf(console, "\n✓ Successfully processed %d/%d images\n", successCount, len(results))
+	if skippedCount > 0 {
+		fmt.Fprintf(console, "↷ Skipped %d up-to-date images\n", skippedCount)
+	}
+	if canceledCount > 0 {
+		fmt.Fprintf(console, "⚠ Interrupted: %d images were not processed\n", canceledCount)
+	}
+	if abortedCount > 0 {
+		fmt.Fprintf(console, "⚠ Stopped after %d failures: %d images were not processed\n", failedCount, abortedCount)
+	}
+
+	err := fmt.Errorf("some images failed to process")
+	if abortedCount > 0 {
+		err = fmt.Errorf("stopped after %d failures", failedCount)
+	}
+
+	switch {
+	case canceledCount > 0:
+		return &exitError{code: ExitInterrupted, err: fmt.Errorf("interrupted before all images were processed")}
+	case successCount == len(results):
+		return nil
+	case successCount == 0:
+		return &exitError{code: ExitTotalFailure, err: err}
+	default:
+		return &exitError{code: ExitPartialFailure, err: err}
+	}
+}
+
+// withInterrupt returns a context that is canceled on SIGINT or SIGTERM.
+// A second signal exits immediately. stop must be called to release resources.
+func withInterrupt() (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case <-signals:
+		case <-done:
+			return
+		}
+		fmt.Fprintln(errConsole, "\n⚠ Interrupted: stopping, unfinished files will be rolled back (press Ctrl-C again to force quit)")
+		cancel()
+
+		select {
+		case <-signals:
+			os.Exit(130)
+		case <-done:
 		}
+	}()
+
+	stop = func() {
+		signal.Stop(signals)
+		close(done)
+		cancel()
+	}
+	return ctx, stop
+}
+
+// startBackupRun starts a backup run when enabled, returning nil otherwise
+func startBackupRun(enabled bool, op string) (*backup.Run, error) {
+	if !enabled {
+		return nil, nil
 	}
+	return backup.NewRun(backup.DefaultDir, op)
+}
 
-	fmt.Printf("\n✓ Successfully processed %d/%d images\n", successCount, len(results))
+// protectFile backs up path before it is overwritten when a run is active
+func protectFile(run *backup.Run, path string) error {
+	if run == nil {
+		return nil
+	}
+	return run.Protect(path)
+}
 
-	if successCount < len(results) {
-		return fmt.Errorf("some images failed to process")
+// finishBackupRun closes the run and tells the user how to restore it
+func finishBackupRun(run *backup.Run) {
+	if run == nil {
+		return
+	}
+	if err := run.Close(); err != nil {
+		fmt.Fprintf(errConsole, "✗ Failed to close backup journal: %v\n", err)
+		return
 	}
+	if run.Empty() {
+		return
+	}
+	fmt.Fprintf(console, "💾 Originals backed up (run %s). Restore with: imgai undo %s\n", run.ID, run.ID)
+}
 
-	return nil
+// writeOutput writes path atomically, creating its directory if needed
+func writeOutput(ctx context.Context, path string, write func(w io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("%w: %w", image.ErrSaveImage, err)
+	}
+	return image.WriteFileAtomic(ctx, nil, path, write)
 }
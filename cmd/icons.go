@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	stdimage "image"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hiroki-abe-58/imgai/pkg/icons"
+	"github.com/hiroki-abe-58/imgai/pkg/image"
+	"github.com/spf13/cobra"
+)
+
+var (
+	iconsOutput     string
+	iconsBackground string
+	iconsName       string
+	iconsThemeColor string
+	iconsPrefix     string
+	iconsBatch      batchFlags
+)
+
+var iconsCmd = &cobra.Command{
+	Use:   "icons [image]",
+	Short: "Generate favicons, app icons and a web manifest from a logo",
+	Long: `Generate a favicon and app icon set from a single logo.
+
+Writes a multi-resolution favicon.ico (16, 32 and 48 px), PNG favicons, Apple
+touch icons, Android/PWA icons and a site.webmanifest to the output directory,
+then prints the HTML <link> tags to paste into your page. Non-square logos are
+centered on a square --background canvas instead of being stretched. Apple
+touch icons are never transparent: they use white when --background is.
+
+Examples:
+  imgai icons logo.png -o public/
+  imgai icons logo.png -o dist/icons --background "#0b3d91" --name "My App" --prefix /icons/`,
+	Args: cobra.ExactArgs(1),
+	RunE: runIcons,
+}
+
+func init() {
+	rootCmd.AddCommand(iconsCmd)
+
+	iconsCmd.Flags().StringVarP(&iconsOutput, "output", "o", "", "Output directory [required]")
+	iconsCmd.Flags().StringVar(&iconsBackground, "background", "transparent", "Canvas color around non-square logos, a name or #rrggbb")
+	iconsCmd.Flags().StringVar(&iconsName, "name", "", "App name in the web manifest (default: logo file name)")
+	iconsCmd.Flags().StringVar(&iconsThemeColor, "theme-color", "#ffffff", "Theme color in the web manifest")
+	iconsCmd.Flags().StringVar(&iconsPrefix, "prefix", "/", "URL prefix of the icons in the manifest and HTML")
+	iconsBatch.registerLimits(iconsCmd)
+
+	iconsCmd.MarkFlagRequired("output")
+}
+
+func runIcons(cmd *cobra.Command, args []string) error {
+	background, err := image.ParseColor(iconsBackground)
+	if err != nil {
+		return usageError(fmt.Errorf("invalid --background: %w", err))
+	}
+	if _, err := image.ParseColor(iconsThemeColor); err != nil {
+		return usageError(fmt.Errorf("invalid --theme-color: %w", err))
+	}
+	if err := iconsBatch.checkLimits(); err != nil {
+		return usageError(err)
+	}
+	prefix := iconsPrefix
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	ctx := cmd.Context()
+	src := args[0]
+
+	cfg, _, err := image.DecodeConfigFile(nil, src)
+	if err != nil {
+		return failureError(err)
+	}
+	if largest := icons.Icons[len(icons.Icons)-1].Size; cfg.Width < largest && cfg.Height < largest {
+		fmt.Fprintf(os.Stderr, "⚠ %s is %dx%d; icons up to %dx%d will be upscaled\n", src, cfg.Width, cfg.Height, largest, largest)
+	}
+	if err := os.MkdirAll(iconsOutput, 0755); err != nil {
+		return failureError(fmt.Errorf("%w: %w", image.ErrSaveImage, err))
+	}
+
+	for _, icon := range icons.Icons {
+		opts := image.ResizeOptions{
+			Width:      icon.Size,
+			Height:     icon.Size,
+			Output:     filepath.Join(iconsOutput, icon.File),
+			Pad:        true,
+			Background: background,
+			Limits:     iconsBatch.limits(),
+		}
+		if icon.Opaque && background.A < 0xff {
+			opts.Background = flatten(background)
+		}
+		if _, err := image.ResizeImage(ctx, src, opts); err != nil {
+			return failureError(err)
+		}
+		fmt.Fprintf(console, "✓ Created %s (%dx%d)\n", opts.Output, icon.Size, icon.Size)
+	}
+
+	if err := writeFavicon(ctx, src, background); err != nil {
+		return failureError(err)
+	}
+	if err := writeManifest(ctx, src, background, prefix); err != nil {
+		return failureError(err)
+	}
+
+	fmt.Fprintln(console, "\n💡 Add these tags to the <head> of your pages:")
+	return icons.WriteHTML(console, prefix)
+}
+
+// writeFavicon writes favicon.ico with the logo at each favicon size
+func writeFavicon(ctx context.Context, src string, background color.Color) error {
+	img, _, err := image.OpenImage(nil, src, iconsBatch.limits())
+	if err != nil {
+		return err
+	}
+	entries := make([]stdimage.Image, len(icons.FaviconSizes))
+	for i, size := range icons.FaviconSizes {
+		entries[i] = image.Resize(img, image.ResizeOptions{Width: size, Height: size, Pad: true, Background: background})
+	}
+
+	path := filepath.Join(iconsOutput, icons.FaviconFile)
+	encode := func(w io.Writer) error {
+		return image.EncodeICO(w, entries)
+	}
+	if err := writeOutput(ctx, path, encode); err != nil {
+		return err
+	}
+	fmt.Fprintf(console, "✓ Created %s (%s)\n", path, joinSizes(icons.FaviconSizes))
+	return nil
+}
+
+// writeManifest writes site.webmanifest for the icon set
+func writeManifest(ctx context.Context, src string, background color.NRGBA, prefix string) error {
+	name := iconsName
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(src), filepath.Ext(src))
+	}
+	opts := icons.ManifestOptions{
+		Name:            name,
+		ThemeColor:      iconsThemeColor,
+		BackgroundColor: hexColor(flatten(background)),
+		Prefix:          prefix,
+	}
+
+	path := filepath.Join(iconsOutput, icons.ManifestFile)
+	write := func(w io.Writer) error {
+		return icons.WriteManifest(w, opts)
+	}
+	if err := writeOutput(ctx, path, write); err != nil {
+		return err
+	}
+	fmt.Fprintf(console, "✓ Created %s\n", path)
+	return nil
+}
+
+// flatten returns c composited over white
+func flatten(c color.NRGBA) color.NRGBA {
+	blend := func(v uint8) uint8 {
+		return uint8((int(v)*int(c.A) + 255*(255-int(c.A))) / 255)
+	}
+	return color.NRGBA{R: blend(c.R), G: blend(c.G), B: blend(c.B), A: 0xff}
+}
+
+// hexColor formats an opaque color as #rrggbb
+func hexColor(c color.NRGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// joinSizes formats square icon sizes as "16x16, 32x32, ..."
+func joinSizes(sizes []int) string {
+	parts := make([]string, len(sizes))
+	for i, size := range sizes {
+		parts[i] = fmt.Sprintf("%dx%d", size, size)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,288 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	stdimage "image"
+	"image/draw"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hiroki-abe-58/imgai/pkg/batch"
+	"github.com/hiroki-abe-58/imgai/pkg/image"
+	"github.com/spf13/cobra"
+)
+
+var (
+	montageOutput     string
+	montageColumns    int
+	montageRows       int
+	montageTile       string
+	montageGap        int
+	montageLabel      string
+	montageBackground string
+	montageQuality    int
+	montageWorkers    int
+	montageBatch      batchFlags
+)
+
+var montageCmd = &cobra.Command{
+	Use:   "montage [image(s)]",
+	Short: "Lay out thumbnails of images on a contact sheet",
+	Long: `Lay out thumbnails of images in a grid on one or more contact sheets.
+
+Thumbnails keep their aspect ratio and are centered in their tile. Large sets
+continue on numbered sheets (sheet-1.jpg, sheet-2.jpg, ...) after --rows rows,
+by default as many as fit in 40 megapixels. Sheets never exceed 65535 pixels,
+the largest JPEG and GIF images (16384 for WebP).
+
+Examples:
+  imgai montage *.jpg -o sheet.jpg
+  imgai montage *.jpg --cols 6 --tile 256x256 --gap 8 --label filename -o sheet.jpg
+  imgai montage shoot/*.jpg --rows 5 --background "#222" -o sheet.png`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runMontage,
+}
+
+func init() {
+	rootCmd.AddCommand(montageCmd)
+
+	montageCmd.Flags().StringVarP(&montageOutput, "output", "o", "", "Output sheet path; the extension selects the format [required]")
+	montageCmd.Flags().IntVar(&montageColumns, "cols", 6, "Number of tiles per row")
+	montageCmd.Flags().IntVar(&montageRows, "rows", 0, "Maximum rows per sheet, continuing on numbered sheets (0 means as many as fit in 40 megapixels)")
+	montageCmd.Flags().StringVar(&montageTile, "tile", "256x256", "Maximum thumbnail size as WIDTHxHEIGHT")
+	montageCmd.Flags().IntVar(&montageGap, "gap", 8, "Space around and between tiles in pixels")
+	montageCmd.Flags().StringVar(&montageLabel, "label", "none", "Caption below each tile: none or filename")
+	montageCmd.Flags().StringVar(&montageBackground, "background", "white", "Sheet background color, a name or #rrggbb")
+	montageCmd.Flags().IntVarP(&montageQuality, "quality", "q", image.DefaultQuality, "JPEG quality (1-100)")
+	montageCmd.Flags().IntVar(&montageWorkers, "workers", 4, "Number of parallel workers")
+	montageBatch.registerLimits(montageCmd)
+
+	montageCmd.MarkFlagRequired("output")
+}
+
+func runMontage(cmd *cobra.Command, args []string) error {
+	opts, err := montageOptions()
+	if err != nil {
+		return usageError(err)
+	}
+	format, err := image.FormatFromPath(montageOutput)
+	if err != nil {
+		return usageError(err)
+	}
+	if !image.CanEncode(format) {
+		return usageError(fmt.Errorf("%w: cannot write %s sheets", image.ErrInvalidFormat, format))
+	}
+	if err := image.ValidateQuality(montageQuality); err != nil {
+		return usageError(err)
+	}
+	if err := montageBatch.checkLimits(); err != nil {
+		return usageError(err)
+	}
+	rows, err := montageSheetRows(opts, format)
+	if err != nil {
+		return usageError(err)
+	}
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+	sheets := &montageWriter{opts: opts, rows: rows, format: format}
+
+	// Decode and shrink inputs concurrently. Thumbnails are drawn in input
+	// order as soon as all earlier inputs are done, and each sheet is
+	// written once it is full.
+	var mu sync.Mutex
+	thumbs := make(map[string]image.Tile)
+	processFunc := func(ctx context.Context, path string) (string, error) {
+		img, _, err := image.OpenImage(nil, path, montageBatch.limits())
+		if err != nil {
+			return "", err
+		}
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		tile := image.Tile{
+			Image: image.Thumbnail(img, opts.TileWidth, opts.TileHeight),
+			Label: filepath.Base(path),
+		}
+		mu.Lock()
+		thumbs[path] = tile
+		mu.Unlock()
+		return "", nil
+	}
+
+	processor := batch.NewProcessor(montageWorkers)
+	processor.SetResultHandler(func(result batch.Result) {
+		mu.Lock()
+		tile, ok := thumbs[result.Path]
+		delete(thumbs, result.Path)
+		mu.Unlock()
+		if !ok || sheets.err != nil {
+			return
+		}
+		if sheets.err = sheets.add(ctx, tile); sheets.err != nil {
+			cancel()
+		}
+	})
+	results := processor.Process(ctx, args, processFunc)
+	if sheets.err != nil {
+		return failureError(sheets.err)
+	}
+	if cmd.Context().Err() != nil {
+		return printResults(results)
+	}
+	if err := sheets.close(ctx); err != nil {
+		return failureError(err)
+	}
+	return printResults(results)
+}
+
+// montageOptions builds the sheet layout from the montage flags
+func montageOptions() (image.MontageOptions, error) {
+	if montageColumns < 1 {
+		return image.MontageOptions{}, fmt.Errorf("--cols must be at least 1")
+	}
+	if montageRows < 0 || montageGap < 0 {
+		return image.MontageOptions{}, fmt.Errorf("--rows and --gap must not be negative")
+	}
+	width, height, err := parseSize(montageTile)
+	if err != nil {
+		return image.MontageOptions{}, fmt.Errorf("invalid --tile: %w", err)
+	}
+	background, err := image.ParseColor(montageBackground)
+	if err != nil {
+		return image.MontageOptions{}, fmt.Errorf("invalid --background: %w", err)
+	}
+
+	opts := image.MontageOptions{
+		Columns:    montageColumns,
+		TileWidth:  width,
+		TileHeight: height,
+		Gap:        montageGap,
+		Background: background,
+	}
+	switch montageLabel {
+	case "none":
+	case "filename":
+		opts.Labels = true
+	default:
+		return image.MontageOptions{}, fmt.Errorf("unsupported label: %s (supported: none, filename)", montageLabel)
+	}
+	return opts, nil
+}
+
+// montageSheetRows returns the number of rows per sheet: --rows, or as
+// many as fit within DefaultSheetPixels and the sheet limit of format. It
+// fails before any input is read when the sheets cannot be encoded.
+func montageSheetRows(opts image.MontageOptions, format string) (int, error) {
+	limit := image.SheetLimit(format)
+	maxRows := image.MaxMontageRows(opts, limit)
+	if maxRows == 0 {
+		return 0, fmt.Errorf("sheets with --cols %d and --tile %s exceed %d pixels; use fewer columns or smaller tiles", opts.Columns, montageTile, limit)
+	}
+	if montageRows > maxRows {
+		return 0, fmt.Errorf("sheets with --rows %d exceed %d pixels; use at most %d rows", montageRows, limit, maxRows)
+	}
+	if montageRows > 0 {
+		return montageRows, nil
+	}
+	return min(maxRows, image.MontageRowsWithin(opts, image.DefaultSheetPixels)), nil
+}
+
+// montageWriter draws tiles onto sheets of at most rows rows and writes
+// each sheet to --output once it is full, so that only one sheet is held
+// in memory. Sheets start small and grow as tiles arrive.
+type montageWriter struct {
+	opts   image.MontageOptions
+	rows   int
+	format string
+
+	sheet    *stdimage.NRGBA
+	capacity int // rows the current sheet has room for
+	tiles    int // tiles on the current sheet
+	sheets   int // sheets started so far
+	err      error
+}
+
+// add draws tile after the previous ones, first writing the current sheet
+// as a numbered sheet if it is full
+func (m *montageWriter) add(ctx context.Context, tile image.Tile) error {
+	perSheet := m.rows * m.opts.Columns
+	if m.sheet != nil && m.tiles == perSheet {
+		if err := m.write(ctx, true); err != nil {
+			return err
+		}
+	}
+	if m.sheet == nil {
+		m.sheets++
+		m.tiles = 0
+		m.capacity = 0
+	}
+
+	// Double the room of the sheet when the next row does not fit
+	if rows := m.tiles/m.opts.Columns + 1; rows > m.capacity {
+		m.capacity = min(max(rows, 2*m.capacity), m.rows)
+		grown := image.NewSheet(m.opts, m.capacity)
+		if m.sheet != nil {
+			draw.Draw(grown, m.sheet.Bounds(), m.sheet, stdimage.Point{}, draw.Src)
+		}
+		m.sheet = grown
+	}
+	image.DrawTile(m.sheet, m.opts, m.tiles, tile)
+	m.tiles++
+	return nil
+}
+
+// close writes the last sheet, numbered if it follows others
+func (m *montageWriter) close(ctx context.Context) error {
+	if m.sheet == nil {
+		return nil
+	}
+	return m.write(ctx, m.sheets > 1)
+}
+
+// write encodes the current sheet cropped to the rows it uses. A single
+// short row is not padded to the full width.
+func (m *montageWriter) write(ctx context.Context, numbered bool) error {
+	opts := m.opts
+	if m.sheets == 1 && m.tiles < opts.Columns {
+		opts.Columns = m.tiles
+	}
+	width, height := image.MontageSize(opts, (m.tiles+m.opts.Columns-1)/m.opts.Columns)
+	sheet := m.sheet.SubImage(stdimage.Rect(0, 0, width, height))
+	m.sheet = nil
+
+	path := montageOutput
+	if numbered {
+		ext := filepath.Ext(montageOutput)
+		path = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(montageOutput, ext), m.sheets, ext)
+	}
+	var result image.Result
+	encode := func(w io.Writer) error {
+		return result.EncodeTo(w, sheet, m.format, montageQuality)
+	}
+	if err := image.WriteFileAtomic(ctx, nil, path, encode); err != nil {
+		return err
+	}
+	fmt.Fprintf(console, "✓ Created sheet: %s (%dx%d, %d images)\n", path, result.Width, result.Height, m.tiles)
+	return nil
+}
+
+// parseSize parses a size given as WIDTHxHEIGHT, or as one number for a square
+func parseSize(s string) (int, int, error) {
+	w, h, found := strings.Cut(strings.ToLower(s), "x")
+	if !found {
+		h = w
+	}
+	width, err := strconv.Atoi(strings.TrimSpace(w))
+	if err != nil || width <= 0 {
+		return 0, 0, fmt.Errorf("invalid size %q (use e.g. 256x256)", s)
+	}
+	height, err := strconv.Atoi(strings.TrimSpace(h))
+	if err != nil || height <= 0 {
+		return 0, 0, fmt.Errorf("invalid size %q (use e.g. 256x256)", s)
+	}
+	return width, height, nil
+}
@@ -1,10 +1,13 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io"
 
 	"github.com/hiroki-abe-58/imgai/pkg/batch"
 	"github.com/hiroki-abe-58/imgai/pkg/image"
+	"github.com/hiroki-abe-58/imgai/pkg/storage"
 	"github.com/spf13/cobra"
 )
 
@@ -14,6 +17,7 @@ var (
 	resizeOutput  string
 	resizeWorkers int
 	resizeDryRun  bool
+	resizeBatch   batchFlags
 )
 
 var resizeCmd = &cobra.Command{
@@ -27,8 +31,13 @@ If both are specified, images will be resized to exact dimensions.
 Examples:
   imgai resize photo.jpg --width 800
   imgai resize *.jpg --width 800 --dry-run
-  imgai resize *.jpg --width 800 --workers 8`,
-	Args: cobra.MinimumNArgs(1),
+  imgai resize *.jpg --width 800 --workers 8
+  find . -name '*.jpg' -print0 | imgai resize --files-from - -0 --width 800
+  cat photo.jpg | imgai resize - --width 800 -o - > small.jpg
+  imgai resize https://cdn.example.com/photos/cat.jpg --width 800
+  imgai resize 's3://assets/photos/*.jpg' --width 800 --out-dir s3://assets/thumbs/
+  imgai resize photos.zip --width 800 --out-archive thumbs.zip`,
+	Args: resizeBatch.inputArgs,
 	RunE: runResize,
 }
 
@@ -37,76 +46,153 @@ func init() {
 
 	resizeCmd.Flags().IntVarP(&resizeWidth, "width", "w", 0, "Target width in pixels")
 	resizeCmd.Flags().IntVar(&resizeHeight, "height", 0, "Target height in pixels")
-	resizeCmd.Flags().StringVarP(&resizeOutput, "output", "o", "", "Output file path (single file only)")
+	resizeCmd.Flags().StringVarP(&resizeOutput, "output", "o", "", "Output file path, or - for stdout (single file only)")
 	resizeCmd.Flags().IntVar(&resizeWorkers, "workers", 4, "Number of parallel workers")
 	resizeCmd.Flags().BoolVar(&resizeDryRun, "dry-run", false, "Preview operations without executing")
+	resizeBatch.register(resizeCmd)
 }
 
 func runResize(cmd *cobra.Command, args []string) error {
 	// Validate dimensions
 	if err := image.ValidateDimensions(resizeWidth, resizeHeight); err != nil {
-		return err
+		return usageError(err)
+	}
+	if err := resizeBatch.setup(args); err != nil {
+		return usageError(err)
+	}
+	if err := checkStdio(args, resizeOutput, &resizeBatch); err != nil {
+		return usageError(err)
+	}
+	if err := resizeBatch.checkOutDir(args, resizeOutput); err != nil {
+		return usageError(err)
 	}
 
 	// Dry-run mode
 	if resizeDryRun {
-		return runResizeDryRun(args)
+		return runResizeDryRun(cmd.Context(), args)
 	}
 
 	// Single file mode with output path
 	if len(args) == 1 && resizeOutput != "" {
-		return runResizeSingle(args[0])
+		return runResizeSingle(cmd.Context(), args[0])
 	}
 
 	// Batch processing mode
-	return runResizeBatch(args)
+	return runResizeBatch(cmd.Context(), args)
 }
 
-func runResizeDryRun(args []string) error {
+func runResizeDryRun(ctx context.Context, args []string) error {
 	printDryRunHeader()
 	
 	processor := batch.NewProcessor(resizeWorkers)
 	processor.SetProgressBar(false)
 	
-	previewFunc := func(path string) error {
+	previewFunc := func(ctx context.Context, path string) (string, error) {
 		outputPath := resizeOutput
 		if outputPath == "" {
 			outputPath = fmt.Sprintf("%s (auto-generated)", path)
 		}
-		fmt.Printf("  Would resize: %s → %s (%dx%d)\n", path, outputPath, resizeWidth, resizeHeight)
-		return nil
+		return outputPath, nil
 	}
+	processor.SetResultHandler(func(result batch.Result) {
+		fmt.Fprintf(console, "  Would resize: %s → %s (%dx%d)\n", result.Path, result.Output, resizeWidth, resizeHeight)
+	})
 	
-	results := processor.Process(args, previewFunc)
+	results := resizeBatch.process(ctx, processor, args, previewFunc)
 	printDryRunFooter(len(results))
 	return nil
 }
 
-func runResizeSingle(inputPath string) error {
-	if err := image.ValidateInputFile(inputPath); err != nil {
+func runResizeSingle(ctx context.Context, inputPath string) error {
+	opts := image.ResizeOptions{
+		Width:  resizeWidth,
+		Height: resizeHeight,
+		Output: resizeOutput,
+		Limits: resizeBatch.limits(),
+	}
+	if isStream(inputPath, resizeOutput) {
+		stream := func(ctx context.Context, r io.Reader, w io.Writer, format string) (image.Result, error) {
+			return image.ResizeStream(ctx, r, w, format, opts)
+		}
+		return resizeBatch.runSingle(ctx, "resize", inputPath, newStreamFunc(resizeOutput, stream), printResized)
+	}
+
+	if !storage.IsRemote(inputPath) {
+		if err := image.ValidateInputFile(nil, inputPath); err != nil {
+			return failureError(err)
+		}
+	}
+	return resizeBatch.runSingle(ctx, "resize", inputPath, newResizeFunc(opts), printResized)
+}
+
+func runResizeBatch(ctx context.Context, args []string) error {
+	processor, cleanup, err := resizeBatch.newProcessor(resizeWorkers)
+	if err != nil {
 		return err
 	}
+	defer cleanup()
 
 	opts := image.ResizeOptions{
 		Width:  resizeWidth,
 		Height: resizeHeight,
-		Output: resizeOutput,
+		Output: "",
+		Limits: resizeBatch.limits(),
 	}
-	return image.ResizeImage(inputPath, opts)
+	if err := resizeBatch.setOperation(processor, "resize", opts); err != nil {
+		return err
+	}
+
+	processor.SetResultHandler(printResized)
+	memOpts := opts
+	if resizeBatch.archives != nil {
+		memOpts.FS, memOpts.Out = resizeBatch.archives.FS(), resizeBatch.archives.FS()
+	}
+	results := resizeBatch.process(ctx, processor, args, resizeBatch.wrap(newResizeFunc(opts), newResizeFunc(memOpts)))
+	if err := resizeBatch.writeArchive(ctx); err != nil {
+		return err
+	}
+	if err := resizeBatch.writeReport("resize", results); err != nil {
+		return err
+	}
+	return printResults(results)
 }
 
-func runResizeBatch(args []string) error {
-	processor := batch.NewProcessor(resizeWorkers)
-	
-	processFunc := func(path string) error {
-		opts := image.ResizeOptions{
-			Width:  resizeWidth,
-			Height: resizeHeight,
-			Output: "",
-		}
-		return image.ResizeImage(path, opts)
+// prepareResizeWatch validates the resize flags parsed for watch and returns
+// the ProcessFunc to run on changed files
+func prepareResizeWatch(processor *batch.Processor) (batch.ProcessFunc, func(), error) {
+	if err := image.ValidateDimensions(resizeWidth, resizeHeight); err != nil {
+		return nil, nil, usageError(err)
 	}
 
-	results := processor.Process(args, processFunc)
-	return printResults(results)
+	opts := image.ResizeOptions{
+		Width:  resizeWidth,
+		Height: resizeHeight,
+		Output: "",
+		Limits: resizeBatch.limits(),
+	}
+	if err := resizeBatch.setOperation(processor, "resize", opts); err != nil {
+		return nil, nil, err
+	}
+	return newResizeFunc(opts), func() {}, nil
+}
+
+// newResizeFunc returns a ProcessFunc that resizes a file with opts
+func newResizeFunc(opts image.ResizeOptions) batch.ProcessFunc {
+	return func(ctx context.Context, path string) (string, error) {
+		result, err := image.ResizeImage(ctx, path, opts)
+		describe(ctx, result)
+		return result.Path, err
+	}
+}
+
+// printResized prints a line for a successfully resized file
+func printResized(result batch.Result) {
+	if !result.Success || result.Skipped {
+		return
+	}
+	if out, ok := resizeBatch.described(result.Path); ok {
+		fmt.Fprintf(console, "✓ Resized: %s → %s (%dx%d)\n", result.Path, result.Output, out.Width, out.Height)
+	} else {
+		fmt.Fprintf(console, "✓ Resized: %s → %s\n", result.Path, result.Output)
+	}
 }
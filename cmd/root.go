@@ -5,6 +5,8 @@ import (
 	"os"
 
 	"github.com/hiroki-abe-58/imgai/pkg/i18n"
+	"github.com/hiroki-abe-58/imgai/pkg/storage"
+	"github.com/hiroki-abe-58/imgai/pkg/storage/s3"
 	"github.com/spf13/cobra"
 )
 
@@ -18,7 +20,7 @@ func getLongDescription() string {
 
 imgaiは以下の機能を提供します：
   • 画像のリサイズと最適化
-  • フォーマット変換（PNG/JPEG/WebP）
+  • フォーマット変換（PNG/JPEG/WebP/GIF/BMP/TIFF）
   • 並列実行によるバッチ処理
   • EXIFメタデータの読み取りと削除
   • プログレスバーとドライランモード
@@ -35,7 +37,7 @@ Goで構築され、Apple Siliconに最適化されています。
 
 imgai provides modern image processing capabilities including:
   • Image resizing and optimization
-  • Format conversion (PNG/JPEG/WebP)
+  • Format conversion (PNG/JPEG/WebP/GIF/BMP/TIFF)
   • Batch processing with parallel execution
   • EXIF metadata reading and removal
   • Progress bar and dry-run mode
@@ -49,26 +51,45 @@ Examples:
   imgai strip photo.jpg`
 }
 
+// commandStarted is set once arguments and flags have been parsed
+// successfully, so earlier errors can be reported as usage errors
+var commandStarted bool
+
 var rootCmd = &cobra.Command{
-	Use:     "imgai",
-	Short:   i18n.T("app_description"),
-	Version: version,
+	Use:           "imgai",
+	Short:         i18n.T("app_description"),
+	Version:       version,
+	SilenceErrors: true,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
 		// Update Long description based on current language
 		cmd.Long = getLongDescription()
+
+		// Arguments are valid from here on; don't print usage for failures
+		commandStarted = true
+		cmd.SilenceUsage = true
 	},
 }
 
 func Execute() {
 	// Set Long description before execution
 	rootCmd.Long = getLongDescription()
-	
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+
+	ctx, stop := withInterrupt()
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+
+	if err != nil {
+		if !commandStarted {
+			err = usageError(err)
+		}
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitCode(err))
 	}
 }
 
 func init() {
 	// Global flags can be added here
+
+	// s3:// inputs and outputs use the standard AWS environment variables
+	storage.Register(s3.Scheme, s3.New(s3.ConfigFromEnv()))
 }
@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/hiroki-abe-58/imgai/pkg/batch"
+	"github.com/hiroki-abe-58/imgai/pkg/cache"
+	"github.com/hiroki-abe-58/imgai/pkg/image"
+	"github.com/hiroki-abe-58/imgai/pkg/server"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveRoot        string
+	serveAddr        string
+	serveWorkers     int
+	serveTimeout     time.Duration
+	serveMaxAge      time.Duration
+	serveMaxPixels   int64
+	serveMaxFileSize byteSize
+	serveMaxWidth    int
+	serveMaxHeight   int
+	serveMaxOutput   int64
+	serveKeyFile     string
+	serveAllow       []string
+	serveCache       string
+	serveCacheSize   byteSize
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve resized and converted images over HTTP",
+	Long: `Serve images from a directory, processed on the fly from the request path.
+
+URLs have the form /<operation>/<options>/<path>, where operation is resize
+or convert and options are w:<width>, h:<height>, q:<quality> and
+format:<format>. Without format, the output format is negotiated from the
+Accept header and the source image.
+
+With a signing key, every URL must be prefixed with its signature as
+generated by "imgai sign", and --allow restricts the accepted operation and
+option combinations. Hidden files and paths leaving the root are refused.
+
+With --cache, processed images are kept on disk keyed by the source content
+and options, and the least recently used are evicted beyond --cache-max-size.
+
+Examples:
+  imgai serve --root ./assets --addr :8080
+  imgai serve --root ./assets --cache .imgai-cache --cache-max-size 2GB
+  curl localhost:8080/resize/w:800/q:80/photos/cat.jpg
+  curl localhost:8080/convert/format:png/photos/cat.jpg
+  imgai serve --root ./assets --key-file secret.key --allow resize/w:800 --allow resize/w:200/format:png`,
+	Args: cobra.NoArgs,
+	RunE: runServe,
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVar(&serveRoot, "root", ".", "Directory to serve source images from")
+	serveCmd.Flags().StringVar(&serveAddr, "addr", ":8080", "Address to listen on")
+	serveCmd.Flags().IntVar(&serveWorkers, "workers", 4, "Number of images processed at once")
+	serveCmd.Flags().DurationVar(&serveTimeout, "timeout", 30*time.Second, "Maximum processing time per image (0 means no limit)")
+	serveCmd.Flags().DurationVar(&serveMaxAge, "max-age", server.DefaultMaxAge, "Cache-Control max-age for processed images")
+	serveCmd.Flags().Int64Var(&serveMaxPixels, "max-pixels", server.DefaultLimits.MaxPixels, "Reject sources with more pixels than this (0 means unlimited)")
+	serveMaxFileSize = byteSize(server.DefaultLimits.MaxFileSize)
+	serveCmd.Flags().Var(&serveMaxFileSize, "max-file-size", "Reject source files larger than this, e.g. 50MB (0 means unlimited)")
+	serveCmd.Flags().IntVar(&serveMaxWidth, "max-width", 0, "Reject sources wider than this many pixels (0 means unlimited)")
+	serveCmd.Flags().IntVar(&serveMaxHeight, "max-height", 0, "Reject sources taller than this many pixels (0 means unlimited)")
+	serveCmd.Flags().Int64Var(&serveMaxOutput, "max-output-pixels", server.DefaultMaxOutputPixels, "Reject requests for resized images with more pixels than this")
+	serveCmd.Flags().StringVar(&serveKeyFile, "key-file", "", "Require URLs signed with the key in this file (default: $"+signingKeyEnv+")")
+	serveCmd.Flags().StringVar(&serveCache, "cache", "", "Keep processed images in this directory (e.g. "+cache.DefaultDir+")")
+	serveCacheSize = cache.DefaultMaxSize
+	serveCmd.Flags().Var(&serveCacheSize, "cache-max-size", "Evict least recently used images from --cache beyond this size")
+	serveCmd.Flags().StringArrayVar(&serveAllow, "allow", nil, "Only serve this operation and options, e.g. resize/w:800/q:80 (repeatable)")
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+	if info, err := os.Stat(serveRoot); err != nil {
+		return usageError(err)
+	} else if !info.IsDir() {
+		return usageError(fmt.Errorf("%s is not a directory", serveRoot))
+	}
+	if serveWorkers <= 0 {
+		return usageError(fmt.Errorf("--workers must be positive"))
+	}
+	if serveMaxOutput <= 0 {
+		return usageError(fmt.Errorf("--max-output-pixels must be positive"))
+	}
+	if serveMaxPixels < 0 || serveMaxWidth < 0 || serveMaxHeight < 0 {
+		return usageError(fmt.Errorf("resource limits must not be negative"))
+	}
+
+	key, err := loadSigningKey(serveKeyFile)
+	if err != nil {
+		return usageError(err)
+	}
+	var presets []server.Params
+	for _, allow := range serveAllow {
+		preset, err := server.ParsePreset(allow)
+		if err != nil {
+			return usageError(fmt.Errorf("--allow %s: %w", allow, err))
+		}
+		presets = append(presets, preset)
+	}
+
+	var store *cache.Store
+	if serveCache != "" {
+		if serveCacheSize <= 0 {
+			return usageError(fmt.Errorf("--cache-max-size must be positive"))
+		}
+		if store, err = cache.Open(serveCache); err != nil {
+			return err
+		}
+		store.SetMaxSize(int64(serveCacheSize))
+	}
+
+	config := batch.NewConfig(serveWorkers)
+	config.Timeout = serveTimeout
+	handler, err := server.New(server.Config{
+		Root:  serveRoot,
+		Batch: config,
+		Limits: image.Limits{
+			MaxPixels:   serveMaxPixels,
+			MaxFileSize: int64(serveMaxFileSize),
+			MaxWidth:    serveMaxWidth,
+			MaxHeight:   serveMaxHeight,
+		},
+		MaxOutputPixels: serveMaxOutput,
+		MaxAge:          serveMaxAge,
+		Key:             key,
+		Presets:         presets,
+		Cache:           store,
+	})
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		fmt.Fprintln(os.Stderr, "⚠ No signing key configured: any processing URL will be served")
+	}
+
+	srv := &http.Server{
+		Addr:              serveAddr,
+		Handler:           logRequests(handler),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return listenAndServe(cmd.Context(), srv, fmt.Sprintf("🌐 Serving %s on %s", serveRoot, serveAddr))
+}
+
+// listenAndServe runs srv until ctx is done, then shuts it down gracefully
+func listenAndServe(ctx context.Context, srv *http.Server, banner string) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	fmt.Fprintf(console, "%s. Press Ctrl-C to stop.\n", banner)
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	fmt.Fprintln(console, "✓ Server stopped")
+	return nil
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests prints one line per request to the console
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		fmt.Fprintf(console, "%s %s %d %v\n", r.Method, r.URL.Path, rec.status, time.Since(start).Round(time.Millisecond))
+	})
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hiroki-abe-58/imgai/pkg/batch"
+	"github.com/hiroki-abe-58/imgai/pkg/server"
+	"github.com/spf13/cobra"
+)
+
+// signingKeyEnv names the environment variable holding the URL signing key
+const signingKeyEnv = "IMGAI_SIGNING_KEY"
+
+var (
+	signKeyFile string
+	signBase    string
+)
+
+var signCmd = &cobra.Command{
+	Use:   "sign [path...]",
+	Short: "Generate signed URLs for imgai serve",
+	Long: `Generate signed processing URLs for a server started with a signing key.
+
+Paths have the form /<operation>/<options>/<source path>, as accepted by
+"imgai serve". Without arguments, paths are read from stdin, one per line.
+The key is read from --key-file or the ` + signingKeyEnv + ` environment variable.
+
+Examples:
+  imgai sign --key-file secret.key /resize/w:800/photos/cat.jpg
+  imgai sign --key-file secret.key --base https://img.example.com < paths.txt`,
+	RunE: runSign,
+}
+
+func init() {
+	rootCmd.AddCommand(signCmd)
+
+	signCmd.Flags().StringVar(&signKeyFile, "key-file", "", "File containing the signing key (default: $"+signingKeyEnv+")")
+	signCmd.Flags().StringVar(&signBase, "base", "", "Base URL to prefix signed paths with, e.g. https://img.example.com")
+}
+
+func runSign(cmd *cobra.Command, args []string) error {
+	key, err := loadSigningKey(signKeyFile)
+	if err != nil {
+		return usageError(err)
+	}
+	if key == nil {
+		return usageError(fmt.Errorf("a signing key is required (--key-file or $%s)", signingKeyEnv))
+	}
+
+	paths := args
+	if len(paths) == 0 {
+		if paths, err = batch.ReadFileList(os.Stdin, false); err != nil {
+			return err
+		}
+	}
+
+	base := strings.TrimSuffix(signBase, "/")
+	for _, p := range paths {
+		params, err := server.ParseParams("/" + strings.TrimPrefix(p, "/"))
+		if err != nil {
+			return usageError(fmt.Errorf("%s: %w", p, err))
+		}
+		fmt.Println(base + server.SignedPath(key, params))
+	}
+	return nil
+}
+
+// loadSigningKey reads the URL signing key from path, or from the
+// environment when path is empty. It returns nil if neither is set.
+func loadSigningKey(path string) ([]byte, error) {
+	key := os.Getenv(signingKeyEnv)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key = string(data)
+	}
+
+	key = strings.TrimSpace(key)
+	if key == "" {
+		if path != "" {
+			return nil, fmt.Errorf("signing key file %s is empty", path)
+		}
+		return nil, nil
+	}
+	return []byte(key), nil
+}
@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	stdimage "image"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/hiroki-abe-58/imgai/pkg/batch"
+	"github.com/hiroki-abe-58/imgai/pkg/image"
+	"github.com/hiroki-abe-58/imgai/pkg/sprite"
+	"github.com/spf13/cobra"
+)
+
+var (
+	spriteOutput  string
+	spriteCSS     string
+	spriteJSON    string
+	spritePadding int
+	spriteClass   string
+	spriteRetina  bool
+	spriteWorkers int
+	spriteBatch   batchFlags
+)
+
+var spriteCmd = &cobra.Command{
+	Use:   "sprite [image(s)]",
+	Short: "Pack images into a sprite sheet with CSS and JSON coordinates",
+	Long: `Pack images into a single PNG atlas and describe where each one was placed.
+
+Each image becomes a sprite named after its file (lowercased, other characters
+replaced by "-"). --css writes a ".<class>-<name>" rule per sprite and --json a
+map of names to coordinates. With --retina, inputs are taken as @2x artwork:
+the atlas gets them scaled to half size and <output>@2x.png the originals.
+
+Examples:
+  imgai sprite icons/*.png -o sprite.png --css sprite.css --json sprite.json
+  imgai sprite icons/*.png -o dist/sprite.png --css dist/sprite.css --retina --class icon`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runSprite,
+}
+
+func init() {
+	rootCmd.AddCommand(spriteCmd)
+
+	spriteCmd.Flags().StringVarP(&spriteOutput, "output", "o", "", "Output PNG atlas path [required]")
+	spriteCmd.Flags().StringVar(&spriteCSS, "css", "", "Write CSS classes for the sprites to this file")
+	spriteCmd.Flags().StringVar(&spriteJSON, "json", "", "Write a JSON map of sprite coordinates to this file")
+	spriteCmd.Flags().IntVar(&spritePadding, "padding", 2, "Space between sprites in pixels")
+	spriteCmd.Flags().StringVar(&spriteClass, "class", "sprite", "CSS class of the atlas and prefix of sprite classes")
+	spriteCmd.Flags().BoolVar(&spriteRetina, "retina", false, "Treat inputs as @2x artwork and also write an @2x atlas")
+	spriteCmd.Flags().IntVar(&spriteWorkers, "workers", 4, "Number of parallel workers")
+	spriteBatch.registerLimits(spriteCmd)
+
+	spriteCmd.MarkFlagRequired("output")
+}
+
+func runSprite(cmd *cobra.Command, args []string) error {
+	if format, err := image.FormatFromPath(spriteOutput); err != nil || format != "png" {
+		return usageError(fmt.Errorf("--output must be a .png file"))
+	}
+	if spritePadding < 0 {
+		return usageError(fmt.Errorf("--padding must not be negative"))
+	}
+	if sprite.Name(spriteClass) != spriteClass || spriteClass == "" {
+		return usageError(fmt.Errorf("invalid --class %q (use lowercase letters, digits, - and _)", spriteClass))
+	}
+	if err := spriteBatch.checkLimits(); err != nil {
+		return usageError(err)
+	}
+	ctx := cmd.Context()
+
+	var mu sync.Mutex
+	decoded := make(map[string]stdimage.Image)
+	processFunc := func(ctx context.Context, path string) (string, error) {
+		img, _, err := image.OpenImage(nil, path, spriteBatch.limits())
+		if err != nil {
+			return "", err
+		}
+		mu.Lock()
+		decoded[path] = img
+		mu.Unlock()
+		return "", nil
+	}
+
+	processor := batch.NewProcessor(spriteWorkers)
+	results := processor.Process(ctx, args, processFunc)
+	if ctx.Err() != nil {
+		return printResults(results)
+	}
+
+	var inputs []sprite.Input
+	for _, result := range results {
+		if result.Success {
+			inputs = append(inputs, sprite.Input{Name: sprite.Name(result.Path), Image: decoded[result.Path]})
+		}
+	}
+	if len(inputs) > 0 {
+		if err := writeSprite(ctx, inputs); err != nil {
+			return failureError(err)
+		}
+	}
+	return printResults(results)
+}
+
+// writeSprite packs inputs and writes the atlas, the @2x atlas with
+// --retina, and the requested manifests
+func writeSprite(ctx context.Context, inputs []sprite.Input) error {
+	var sheet, retina *sprite.Sheet
+	var err error
+	if spriteRetina {
+		sheet, retina, err = sprite.PackRetina(inputs, spritePadding)
+	} else {
+		sheet, err = sprite.Pack(inputs, spritePadding)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := writeAtlas(ctx, spriteOutput, sheet); err != nil {
+		return err
+	}
+	retinaOutput := ""
+	if retina != nil {
+		ext := filepath.Ext(spriteOutput)
+		retinaOutput = strings.TrimSuffix(spriteOutput, ext) + "@2x" + ext
+		if err := writeAtlas(ctx, retinaOutput, retina); err != nil {
+			return err
+		}
+	}
+
+	if spriteCSS != "" {
+		retinaURL := ""
+		if retinaOutput != "" {
+			retinaURL = relativeURL(spriteCSS, retinaOutput)
+		}
+		write := func(w io.Writer) error {
+			return sheet.WriteCSS(w, spriteClass, relativeURL(spriteCSS, spriteOutput), retinaURL)
+		}
+		if err := writeOutput(ctx, spriteCSS, write); err != nil {
+			return err
+		}
+		fmt.Fprintf(console, "✓ Wrote CSS: %s\n", spriteCSS)
+	}
+	if spriteJSON != "" {
+		write := func(w io.Writer) error {
+			return sheet.WriteJSON(w, relativeURL(spriteJSON, spriteOutput))
+		}
+		if err := writeOutput(ctx, spriteJSON, write); err != nil {
+			return err
+		}
+		fmt.Fprintf(console, "✓ Wrote JSON: %s\n", spriteJSON)
+	}
+	return nil
+}
+
+// writeAtlas draws sheet and writes it as a PNG to path
+func writeAtlas(ctx context.Context, path string, sheet *sprite.Sheet) error {
+	atlas := sheet.Image()
+	encode := func(w io.Writer) error {
+		return image.Encode(w, atlas, "png", 0)
+	}
+	if err := writeOutput(ctx, path, encode); err != nil {
+		return err
+	}
+	fmt.Fprintf(console, "✓ Created sprite sheet: %s (%dx%d, %d sprites)\n", path, sheet.Width, sheet.Height, len(sheet.Sprites))
+	return nil
+}
+
+// relativeURL returns the URL of target relative to the file at from
+func relativeURL(from, target string) string {
+	rel, err := filepath.Rel(filepath.Dir(from), target)
+	if err != nil {
+		rel = filepath.Base(target)
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,339 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/hiroki-abe-58/imgai/pkg/archive"
+	"github.com/hiroki-abe-58/imgai/pkg/batch"
+	"github.com/hiroki-abe-58/imgai/pkg/image"
+	"github.com/hiroki-abe-58/imgai/pkg/remote"
+	"github.com/hiroki-abe-58/imgai/pkg/storage"
+)
+
+// checkOutDir rejects --out-dir, --out-archive and archive inputs combined
+// with an explicit output path
+func (f *batchFlags) checkOutDir(args []string, output string) error {
+	if output == "" {
+		return nil
+	}
+	if f.outDir != "" {
+		return fmt.Errorf("--out-dir cannot be combined with --output")
+	}
+	if f.outArchive != "" {
+		return fmt.Errorf("--out-archive cannot be combined with --output")
+	}
+	if hasArchive(f.inputs(args)) {
+		return fmt.Errorf("--output cannot be used with archive inputs (use --out-dir or --out-archive)")
+	}
+	return nil
+}
+
+// setupArchives prepares reading archive inputs and writing --out-archive
+func (f *batchFlags) setupArchives(args []string) error {
+	if f.outArchive == "" && !hasArchive(f.inputs(args)) {
+		return nil
+	}
+	if f.cache != "" || f.resume {
+		return fmt.Errorf("--cache and --resume cannot be used with archives")
+	}
+	if f.outArchive != "" {
+		if f.outDir != "" {
+			return fmt.Errorf("--out-archive cannot be combined with --out-dir")
+		}
+		writer, err := archive.NewWriter(f.outArchive)
+		if err != nil {
+			return err
+		}
+		f.archiveOut = writer
+	}
+	limits := archive.Limits{
+		MaxMemberSize: int64(f.maxFileSize),
+		MaxTotalSize:  int64(f.maxArchiveSize),
+		MaxMembers:    f.maxArchiveImages,
+	}
+	f.archives = archive.NewReader(nil, limits)
+	return nil
+}
+
+// hasArchive returns true if any local input is a zip or tar archive
+func hasArchive(inputs []string) bool {
+	for _, input := range inputs {
+		if archive.IsArchive(input) && !storage.IsRemote(input) {
+			return true
+		}
+	}
+	return false
+}
+
+// stage runs local on a local copy of remote inputs, and of every input
+// when --out-dir or --out-archive is set so that inputs are never modified.
+// Outputs written next to the copy go to --out-dir, --out-archive or the
+// current directory. Archive members are processed by inMemory on the
+// in-memory FS of the archives, with names as returned by Name, and their
+// outputs are published from there.
+func (f *batchFlags) stage(local, inMemory batch.ProcessFunc) batch.ProcessFunc {
+	return func(ctx context.Context, path string) (string, error) {
+		var parent, rel string
+		if f.archives != nil {
+			parent, rel, _ = f.archives.Archive(path)
+		}
+
+		switch {
+		case parent != "":
+			mem := f.archives.FS()
+			output, err := inMemory(ctx, f.archives.Name(path))
+			if err != nil {
+				return "", err
+			}
+			// Published outputs no longer need to be held in memory
+			defer mem.Remove(output)
+			data, err := mem.ReadFile(output)
+			if err != nil {
+				return "", fmt.Errorf("%w: %w", image.ErrSaveImage, err)
+			}
+			// Archive members keep their place in the archive, next to it
+			// unless --out-dir or --out-archive is set
+			name := filepath.Join(filepath.Dir(filepath.FromSlash(rel)), storage.Base(output))
+			if f.outDir == "" && f.archiveOut == nil {
+				name = filepath.Join(filepath.Dir(parent), name)
+			}
+			return f.publish(ctx, path, data, name)
+
+		case storage.IsRemote(path) || f.outDir != "" || f.archiveOut != nil:
+			staged, dir, err := f.download(ctx, path)
+			if err != nil {
+				return "", err
+			}
+			defer os.RemoveAll(dir)
+
+			output, err := local(ctx, staged)
+			if err != nil || filepath.Dir(output) != dir {
+				return output, err
+			}
+			data, err := os.ReadFile(output)
+			if err != nil {
+				return "", fmt.Errorf("%w: %w", image.ErrSaveImage, err)
+			}
+			return f.publish(ctx, path, data, f.outputName(path, output))
+		}
+		return local(ctx, path)
+	}
+}
+
+// download copies path into a new temporary directory and returns the copy
+// and the directory
+func (f *batchFlags) download(ctx context.Context, path string) (string, string, error) {
+	if remote.IsURL(path) {
+		download, err := f.fetcher.Fetch(ctx, path, "")
+		if err != nil {
+			return "", "", err
+		}
+		return download.Path, download.Dir(), nil
+	}
+
+	r, err := storage.Open(ctx, path)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %w", image.ErrOpenFile, err)
+	}
+	defer r.Close()
+
+	dir, err := os.MkdirTemp("", ".imgai-fetch-")
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %w", image.ErrOpenFile, err)
+	}
+	dir = filepath.Clean(dir)
+	local := filepath.Join(dir, storage.Base(path))
+	if err := copyLimited(local, r, int64(f.maxFileSize)); err != nil {
+		os.RemoveAll(dir)
+		return "", "", err
+	}
+	return local, dir, nil
+}
+
+// copyLimited writes r to path, failing with a LimitError once more than
+// maxSize bytes are read (0 means unlimited)
+func copyLimited(path string, r io.Reader, maxSize int64) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("%w: %w", image.ErrOpenFile, err)
+	}
+	if maxSize > 0 {
+		r = io.LimitReader(r, maxSize+1)
+	}
+	n, err := io.Copy(file, r)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", image.ErrOpenFile, err)
+	}
+	if maxSize > 0 && n > maxSize {
+		return &image.LimitError{Limit: "file size", Value: n, Max: maxSize}
+	}
+	return nil
+}
+
+// publish adds data, the staged output of input, to --out-archive, or
+// writes it as name in --out-dir or relative to the current directory, and
+// returns its new name
+func (f *batchFlags) publish(ctx context.Context, input string, data []byte, name string) (string, error) {
+	if f.archiveOut != nil {
+		entry, err := f.archiveOut.Add(filepath.ToSlash(name), data)
+		if errors.Is(err, archive.ErrExists) {
+			return "", fmt.Errorf("%w: %s in %s is also the output of another input", image.ErrSaveImage, filepath.ToSlash(name), f.outArchive)
+		}
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", image.ErrSaveImage, err)
+		}
+		return storage.Join(f.outArchive, entry), nil
+	}
+
+	dest := name
+	if f.outDir != "" {
+		dest = storage.Join(f.outDir, name)
+	}
+	if err := f.claim(dest, input); err != nil {
+		return "", err
+	}
+	// Outputs of remote inputs land in the current directory, which may hold
+	// unrelated files of the same name
+	if storage.IsRemote(input) && f.outDir == "" && !f.overwrite {
+		if _, err := os.Stat(dest); err == nil {
+			return "", fmt.Errorf("%w: %s already exists (use --overwrite to replace it)", image.ErrSaveImage, dest)
+		}
+	}
+	if err := storage.WriteFile(ctx, dest, data); err != nil {
+		return "", fmt.Errorf("%w: %w", image.ErrSaveImage, err)
+	}
+	return dest, nil
+}
+
+// claim reserves dest for the output of input, failing when another input
+// of the run already wrote there so that no output is silently replaced
+func (f *batchFlags) claim(dest, input string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.published == nil {
+		f.published = make(map[string]string)
+	}
+	if other, ok := f.published[dest]; ok && other != input {
+		return fmt.Errorf("%w: %s is also the output of %s", image.ErrSaveImage, dest, other)
+	}
+	f.published[dest] = input
+	return nil
+}
+
+// outputName returns the name of the staged output of input relative to
+// --out-dir, --out-archive or the current directory: the directory of input
+// below the common root of the inputs, followed by the output file name
+func (f *batchFlags) outputName(input, output string) string {
+	name := storage.Base(output)
+	group, key := rootKey(input)
+	root, ok := f.roots[group]
+	if !ok {
+		return name
+	}
+	rel := strings.TrimPrefix(strings.TrimPrefix(key, root), "/")
+	if group == "" {
+		var err error
+		if rel, err = filepath.Rel(root, key); err != nil || strings.HasPrefix(rel, "..") {
+			return name
+		}
+		rel = filepath.ToSlash(rel)
+	}
+	// Directories never climb out of the destination
+	if dir := path.Clean(path.Dir(rel)); dir != "." && dir != ".." && !strings.HasPrefix(dir, "../") {
+		return filepath.Join(filepath.FromSlash(dir), name)
+	}
+	return name
+}
+
+// inputRoots returns the deepest directory shared by the inputs of each
+// group, e.g. "photos" for "photos/*.jpg". Glob patterns count from their
+// first segment with a wildcard. Archives are left out as their members
+// keep their own paths.
+func inputRoots(inputs []string) map[string]string {
+	roots := make(map[string]string)
+	for _, input := range inputs {
+		if hasArchive([]string{input}) {
+			continue
+		}
+		group, key := rootKey(input)
+		sep := "/"
+		if group == "" {
+			sep = string(filepath.Separator)
+		}
+		parts := strings.Split(key, sep)
+		end := len(parts) - 1
+		for i, part := range parts {
+			if strings.ContainsAny(part, "*?[") {
+				end = i
+				break
+			}
+		}
+		root := strings.Join(parts[:end], sep)
+		if group == "" && root == "" && strings.HasPrefix(key, sep) {
+			root = sep
+		}
+
+		if prev, ok := roots[group]; ok {
+			root = commonDir(prev, root, sep)
+		}
+		roots[group] = root
+	}
+	return roots
+}
+
+// rootKey returns the group an input's root is shared within and the path
+// compared between them: absolute local paths, host and path for URLs, or
+// the name after the scheme for other remote inputs
+func rootKey(input string) (string, string) {
+	if remote.IsURL(input) {
+		if u, err := url.Parse(input); err == nil {
+			return "http", u.Host + path.Clean("/"+u.Path)
+		}
+	}
+	scheme := storage.Scheme(input)
+	if scheme == "" {
+		if abs, err := filepath.Abs(input); err == nil {
+			return "", abs
+		}
+		return "", filepath.Clean(input)
+	}
+	return scheme, input[len(scheme)+len("://"):]
+}
+
+// commonDir returns the longest directory prefix of a and b
+func commonDir(a, b, sep string) string {
+	as, bs := strings.Split(a, sep), strings.Split(b, sep)
+	n := 0
+	for n < len(as) && n < len(bs) && as[n] == bs[n] {
+		n++
+	}
+	common := strings.Join(as[:n], sep)
+	if common == "" && strings.HasPrefix(a, sep) && strings.HasPrefix(b, sep) {
+		return sep
+	}
+	return common
+}
+
+// writeArchive writes --out-archive with the outputs of all files that
+// completed, including when the run was interrupted
+func (f *batchFlags) writeArchive(ctx context.Context) error {
+	if f.archiveOut == nil || f.archiveOut.Len() == 0 {
+		return nil
+	}
+	if err := f.archiveOut.Commit(context.WithoutCancel(ctx)); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	fmt.Fprintf(console, "📦 Wrote %d images to %s\n", f.archiveOut.Len(), f.outArchive)
+	return nil
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hiroki-abe-58/imgai/pkg/batch"
+	"github.com/hiroki-abe-58/imgai/pkg/image"
+)
+
+// stdio is the path that names stdin as an input and stdout as an output
+const stdio = "-"
+
+// streamFunc decodes an image from r and encodes the result to w in format,
+// or in the input format when format is empty
+type streamFunc func(ctx context.Context, r io.Reader, w io.Writer, format string) (image.Result, error)
+
+// isStream returns true if a single-file run reads stdin or writes stdout
+func isStream(input, output string) bool {
+	return input == stdio || output == stdio
+}
+
+// checkStdio validates "-" inputs and outputs and keeps stdout clean for
+// image data when it is the output
+func checkStdio(args []string, output string, f *batchFlags) error {
+	for _, arg := range args {
+		if arg == stdio && len(args) > 1 {
+			return fmt.Errorf("- (stdin) must be the only input")
+		}
+	}
+	if output == stdio && len(args) != 1 {
+		return fmt.Errorf("-o - (stdout) requires a single input")
+	}
+	if len(args) == 1 && args[0] == stdio && output == "" {
+		return fmt.Errorf("reading from stdin requires --output (use -o - for stdout)")
+	}
+	if output == stdio {
+		if f.report != "" && f.reportFile == stdio {
+			return fmt.Errorf("--report-file is required when writing the image to stdout")
+		}
+		console = os.Stderr
+	}
+	return nil
+}
+
+// newStreamFunc adapts fn into a ProcessFunc for single-file runs, where
+// "-" names stdin as the input path or stdout as the output. Output files
+// get their format from the extension and are written atomically.
+func newStreamFunc(output string, fn streamFunc) batch.ProcessFunc {
+	return func(ctx context.Context, path string) (string, error) {
+		var r io.Reader = os.Stdin
+		if path != stdio {
+			file, err := os.Open(path)
+			if err != nil {
+				return "", fmt.Errorf("%w: %w", image.ErrOpenFile, err)
+			}
+			defer file.Close()
+			r = file
+		}
+
+		if output == stdio {
+			w := bufio.NewWriter(os.Stdout)
+			result, err := fn(ctx, r, w, "")
+			if err != nil {
+				return "", err
+			}
+			describe(ctx, result)
+			if err := w.Flush(); err != nil {
+				return "", fmt.Errorf("%w: %w", image.ErrSaveImage, err)
+			}
+			return stdio, nil
+		}
+
+		format, err := image.FormatFromPath(output)
+		if err != nil {
+			return "", err
+		}
+		// Encode fully before touching the output so decode errors
+		// never leave a partial file behind
+		var buf bytes.Buffer
+		result, err := fn(ctx, r, &buf, format)
+		if err != nil {
+			return "", err
+		}
+		describe(ctx, result)
+		write := func(w io.Writer) error {
+			_, err := buf.WriteTo(w)
+			return err
+		}
+		if err := image.WriteFileAtomic(ctx, nil, output, write); err != nil {
+			return "", err
+		}
+		return output, nil
+	}
+}
@@ -1,10 +1,15 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io"
 
+	"github.com/hiroki-abe-58/imgai/pkg/backup"
 	"github.com/hiroki-abe-58/imgai/pkg/batch"
+	"github.com/hiroki-abe-58/imgai/pkg/image"
 	"github.com/hiroki-abe-58/imgai/pkg/metadata"
+	"github.com/hiroki-abe-58/imgai/pkg/storage"
 	"github.com/spf13/cobra"
 )
 
@@ -12,6 +17,8 @@ var (
 	stripOutput  string
 	stripWorkers int
 	stripDryRun  bool
+	stripBackup  bool
+	stripBatch   batchFlags
 )
 
 var stripCmd = &cobra.Command{
@@ -20,76 +27,190 @@ var stripCmd = &cobra.Command{
 	Long: `Remove all EXIF metadata from one or multiple images for privacy protection.
 
 Warning: By default, this command overwrites the original file.
-Use --output to save to a different location.
+Use --output, --out-dir or --out-archive to save to a different location, or
+--backup to keep a copy of the originals that can be restored with "imgai undo".
 
 Examples:
   imgai strip photo.jpg
   imgai strip *.jpg --dry-run
-  imgai strip *.jpg --workers 8`,
-	Args: cobra.MinimumNArgs(1),
+  imgai strip *.jpg --workers 8
+  imgai strip *.jpg --backup
+  imgai strip photos.zip --out-archive clean.zip
+  curl -s https://example.com/photo.jpg | imgai strip - -o - > clean.jpg`,
+	Args: stripBatch.inputArgs,
 	RunE: runStrip,
 }
 
 func init() {
 	rootCmd.AddCommand(stripCmd)
 
-	stripCmd.Flags().StringVarP(&stripOutput, "output", "o", "", "Output file path (single file only, default: overwrite)")
+	stripCmd.Flags().StringVarP(&stripOutput, "output", "o", "", "Output file path, or - for stdout (single file only, default: overwrite)")
 	stripCmd.Flags().IntVar(&stripWorkers, "workers", 4, "Number of parallel workers")
 	stripCmd.Flags().BoolVar(&stripDryRun, "dry-run", false, "Preview operations without executing")
+	stripCmd.Flags().BoolVar(&stripBackup, "backup", false, "Back up originals to "+backup.DefaultDir+" before overwriting")
+	stripBatch.register(stripCmd)
 }
 
 func runStrip(cmd *cobra.Command, args []string) error {
+	if err := stripBatch.setup(args); err != nil {
+		return usageError(err)
+	}
+	if err := checkStdio(args, stripOutput, &stripBatch); err != nil {
+		return usageError(err)
+	}
+	if err := stripBatch.checkOutDir(args, stripOutput); err != nil {
+		return usageError(err)
+	}
+	if stripBackup && stripBatch.outDir != "" {
+		return usageError(fmt.Errorf("--backup is not needed with --out-dir, which leaves inputs unchanged"))
+	}
+	if stripBackup && stripBatch.outArchive != "" {
+		return usageError(fmt.Errorf("--backup is not needed with --out-archive, which leaves inputs unchanged"))
+	}
+	if hasArchive(stripBatch.inputs(args)) && stripBatch.outDir == "" && stripBatch.outArchive == "" {
+		return usageError(fmt.Errorf("stripping images in an archive requires --out-dir or --out-archive"))
+	}
+
 	// Dry-run mode
 	if stripDryRun {
-		return runStripDryRun(args)
+		return runStripDryRun(cmd.Context(), args)
 	}
 
 	// Single file mode with output path
 	if len(args) == 1 && stripOutput != "" {
-		return runStripSingle(args[0])
+		return runStripSingle(cmd.Context(), args[0])
 	}
 
 	// Batch processing mode
-	return runStripBatch(args)
+	return runStripBatch(cmd.Context(), args)
 }
 
-func runStripDryRun(args []string) error {
+func runStripDryRun(ctx context.Context, args []string) error {
 	printDryRunHeader()
 	
 	processor := batch.NewProcessor(stripWorkers)
 	processor.SetProgressBar(false)
 	
-	previewFunc := func(path string) error {
+	previewFunc := func(ctx context.Context, path string) (string, error) {
 		outputPath := stripOutput
-		if outputPath == "" {
+		switch {
+		case stripBatch.outDir != "":
+			outputPath = storage.Join(stripBatch.outDir, storage.Base(path))
+		case stripBatch.outArchive != "":
+			outputPath = storage.Join(stripBatch.outArchive, storage.Base(path))
+		case outputPath == "":
 			outputPath = path + " (overwrite)"
 		}
-		fmt.Printf("  Would strip metadata: %s → %s\n", path, outputPath)
-		return nil
+		return outputPath, nil
 	}
+	processor.SetResultHandler(func(result batch.Result) {
+		fmt.Fprintf(console, "  Would strip metadata: %s → %s\n", result.Path, result.Output)
+	})
 	
-	results := processor.Process(args, previewFunc)
+	results := stripBatch.process(ctx, processor, args, previewFunc)
 	printDryRunFooter(len(results))
 	return nil
 }
 
-func runStripSingle(inputPath string) error {
+func runStripSingle(ctx context.Context, inputPath string) error {
+	run, err := startBackupRun(stripBackup, "strip")
+	if err != nil {
+		return err
+	}
+	defer finishBackupRun(run)
+
 	opts := metadata.StripOptions{
 		Output: stripOutput,
+		Limits: stripBatch.limits(),
 	}
-	return metadata.StripExif(inputPath, opts)
+	if isStream(inputPath, stripOutput) {
+		stream := func(ctx context.Context, r io.Reader, w io.Writer, format string) (image.Result, error) {
+			if stripOutput != stdio {
+				if err := protectFile(run, stripOutput); err != nil {
+					return image.Result{}, err
+				}
+			}
+			return metadata.StripStream(ctx, r, w, format, opts)
+		}
+		return stripBatch.runSingle(ctx, "strip", inputPath, newStreamFunc(stripOutput, stream), printStripped)
+	}
+	return stripBatch.runSingle(ctx, "strip", inputPath, newStripFunc(run, opts), printStripped)
 }
 
-func runStripBatch(args []string) error {
-	processor := batch.NewProcessor(stripWorkers)
-	
-	processFunc := func(path string) error {
-		opts := metadata.StripOptions{
-			Output: "",
-		}
-		return metadata.StripExif(path, opts)
+func runStripBatch(ctx context.Context, args []string) error {
+	run, err := startBackupRun(stripBackup, "strip")
+	if err != nil {
+		return err
+	}
+	defer finishBackupRun(run)
+
+	processor, cleanup, err := stripBatch.newProcessor(stripWorkers)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	opts := metadata.StripOptions{
+		Output: "",
+		Limits: stripBatch.limits(),
+	}
+	if err := stripBatch.setOperation(processor, "strip", opts); err != nil {
+		return err
 	}
 
-	results := processor.Process(args, processFunc)
+	processor.SetResultHandler(printStripped)
+	memOpts := opts
+	if stripBatch.archives != nil {
+		memOpts.FS, memOpts.Out = stripBatch.archives.FS(), stripBatch.archives.FS()
+	}
+	results := stripBatch.process(ctx, processor, args, stripBatch.wrap(newStripFunc(run, opts), newStripFunc(nil, memOpts)))
+	if err := stripBatch.writeArchive(ctx); err != nil {
+		return err
+	}
+	if err := stripBatch.writeReport("strip", results); err != nil {
+		return err
+	}
 	return printResults(results)
 }
+
+// prepareStripWatch returns the ProcessFunc watch runs on changed files.
+// With --backup, all files changed during the watch share one backup run.
+func prepareStripWatch(processor *batch.Processor) (batch.ProcessFunc, func(), error) {
+	run, err := startBackupRun(stripBackup, "strip")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts := metadata.StripOptions{
+		Output: "",
+		Limits: stripBatch.limits(),
+	}
+	if err := stripBatch.setOperation(processor, "strip", opts); err != nil {
+		finishBackupRun(run)
+		return nil, nil, err
+	}
+	return newStripFunc(run, opts), func() { finishBackupRun(run) }, nil
+}
+
+// newStripFunc returns a ProcessFunc that strips metadata from a file,
+// backing up the file it overwrites when run is not nil
+func newStripFunc(run *backup.Run, opts metadata.StripOptions) batch.ProcessFunc {
+	return func(ctx context.Context, path string) (string, error) {
+		target := opts.Output
+		if target == "" {
+			target = path
+		}
+		if err := protectFile(run, target); err != nil {
+			return "", err
+		}
+		result, err := metadata.StripExif(ctx, path, opts)
+		return result.Path, err
+	}
+}
+
+// printStripped prints a line for a successfully stripped file
+func printStripped(result batch.Result) {
+	if result.Success && !result.Skipped {
+		fmt.Fprintf(console, "✓ Stripped metadata: %s\n", result.Output)
+	}
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hiroki-abe-58/imgai/pkg/backup"
+	"github.com/spf13/cobra"
+)
+
+var (
+	undoList bool
+)
+
+var undoCmd = &cobra.Command{
+	Use:   "undo [run-id]",
+	Short: "Restore files changed by a previous --backup run",
+	Long: `Restore files changed by a previous run that used --backup.
+
+Without a run ID, the most recent run is undone. Restored runs are
+removed from the backup directory, so repeated undo walks back in time.
+
+Examples:
+  imgai undo
+  imgai undo 20250101-120000-000000000
+  imgai undo --list`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runUndo,
+}
+
+func init() {
+	rootCmd.AddCommand(undoCmd)
+
+	undoCmd.Flags().BoolVar(&undoList, "list", false, "List recorded runs instead of restoring")
+}
+
+func runUndo(cmd *cobra.Command, args []string) error {
+	if undoList {
+		return runUndoList()
+	}
+
+	id := ""
+	if len(args) == 1 {
+		id = args[0]
+	}
+
+	entries, err := backup.Undo(backup.DefaultDir, id)
+	if errors.Is(err, backup.ErrUnknownRun) {
+		return usageError(err)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.Created {
+			fmt.Printf("✓ Removed: %s\n", entry.Path)
+		} else {
+			fmt.Printf("✓ Restored: %s\n", entry.Path)
+		}
+	}
+	fmt.Printf("\n✓ Undid %d file changes\n", len(entries))
+	return nil
+}
+
+func runUndoList() error {
+	runs, err := backup.ListRuns(backup.DefaultDir)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		fmt.Println("No backup runs found.")
+		return nil
+	}
+
+	for _, run := range runs {
+		fmt.Printf("%s  %-8s %d files  %s\n", run.ID, run.Op, run.Files, run.Started.Format("2006-01-02 15:04:05"))
+	}
+	return nil
+}
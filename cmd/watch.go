@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hiroki-abe-58/imgai/pkg/batch"
+	"github.com/hiroki-abe-58/imgai/pkg/image"
+	"github.com/hiroki-abe-58/imgai/pkg/watch"
+	"github.com/spf13/cobra"
+)
+
+var (
+	watchDebounce     time.Duration
+	watchPoll         bool
+	watchPollInterval time.Duration
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch <dir> -- <command> [flags]",
+	Short: "Process new and changed images in a directory continuously",
+	Long: `Watch a directory and run a command on images that are added or changed.
+
+Files are handled once they have stopped changing for the --debounce period,
+so exports that are still being written are not picked up early. Outputs
+written by the watch itself are never processed again. Native file system
+notifications are used where available; use --poll for network shares.
+
+Supported commands: resize, convert, strip
+
+Examples:
+  imgai watch exports -- resize --width 1200
+  imgai watch exports -- convert --format png --workers 2
+  imgai watch /mnt/share --poll -- strip --backup`,
+	Args: watchArgs,
+	RunE: runWatch,
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	watchCmd.Flags().DurationVar(&watchDebounce, "debounce", watch.DefaultDebounce, "How long a file must stay unchanged before it is processed")
+	watchCmd.Flags().BoolVar(&watchPoll, "poll", false, "Poll the directory instead of using file system notifications")
+	watchCmd.Flags().DurationVar(&watchPollInterval, "poll-interval", watch.DefaultPollInterval, "Directory scan interval when polling")
+}
+
+// watchTarget describes a command that watch can run on changed files
+type watchTarget struct {
+	cmd     *cobra.Command
+	batch   *batchFlags
+	workers *int
+	print   func(batch.Result)
+
+	// prepare validates the parsed flags and returns the ProcessFunc to
+	// run and a cleanup function called when watching stops
+	prepare func(processor *batch.Processor) (batch.ProcessFunc, func(), error)
+}
+
+// watchTargets returns the commands supported by watch by name
+func watchTargets() map[string]watchTarget {
+	return map[string]watchTarget{
+		"resize":  {resizeCmd, &resizeBatch, &resizeWorkers, printResized, prepareResizeWatch},
+		"convert": {convertCmd, &convertBatch, &convertWorkers, printConverted, prepareConvertWatch},
+		"strip":   {stripCmd, &stripBatch, &stripWorkers, printStripped, prepareStripWatch},
+	}
+}
+
+// watchArgs requires a directory followed by -- and a command
+func watchArgs(cmd *cobra.Command, args []string) error {
+	if dash := cmd.ArgsLenAtDash(); dash != 1 || len(args) < 2 {
+		return fmt.Errorf("usage: imgai watch <dir> -- <command> [flags]")
+	}
+	return nil
+}
+
+func runWatch(cmd *cobra.Command, args []string) error {
+	dir := args[0]
+	if info, err := os.Stat(dir); err != nil {
+		return usageError(err)
+	} else if !info.IsDir() {
+		return usageError(fmt.Errorf("%s is not a directory", dir))
+	}
+
+	target, err := parseWatchCommand(args[1], args[2:])
+	if err != nil {
+		return usageError(err)
+	}
+
+	processor, cleanup, err := target.batch.newProcessor(*target.workers)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	processor.SetProgressBar(false)
+
+	processFunc, finish, err := target.prepare(processor)
+	if err != nil {
+		return err
+	}
+	defer finish()
+	processFunc = target.batch.describing(processFunc)
+
+	// Remember what the watch wrote so its own outputs, including files
+	// rewritten in place, are not picked up as new changes. Only outputs in
+	// the watched directory are kept, until their change is seen.
+	outputs := make(map[string]os.FileInfo)
+	processor.SetResultHandler(func(result batch.Result) {
+		target.print(result)
+		output := filepath.Clean(result.Output)
+		if !result.Success || filepath.Dir(output) != filepath.Clean(dir) {
+			return
+		}
+		if info, err := os.Stat(output); err == nil {
+			outputs[output] = info
+		}
+	})
+
+	handle := func(ctx context.Context, files []string) {
+		var changed []string
+		for _, path := range files {
+			written, ok := outputs[path]
+			delete(outputs, path)
+			info, err := os.Stat(path)
+			if err != nil {
+				continue // removed again before it settled
+			}
+			if !ok || !sameFile(info, written) {
+				changed = append(changed, path)
+			}
+		}
+		if len(changed) == 0 {
+			return
+		}
+
+		fmt.Fprintf(console, "\n📥 %d changed image(s) at %s\n", len(changed), time.Now().Format("15:04:05"))
+		results := processor.ProcessFiles(ctx, changed, processFunc)
+		// Failures are reported per round; the watch keeps running
+		_ = printResults(results)
+	}
+
+	opts := watch.Options{
+		Debounce:     watchDebounce,
+		PollInterval: watchPollInterval,
+		Poll:         watchPoll,
+		Filter:       isWatchCandidate,
+	}
+	fmt.Fprintf(console, "👀 Watching %s (%s). Press Ctrl-C to stop.\n", dir, args[1])
+	if err := watch.Watch(cmd.Context(), dir, opts, handle); err != nil {
+		return err
+	}
+	fmt.Fprintln(console, "\n✓ Stopped watching")
+	return nil
+}
+
+// parseWatchCommand parses the flags of the command watch runs
+func parseWatchCommand(name string, args []string) (watchTarget, error) {
+	target, ok := watchTargets()[name]
+	if !ok {
+		return watchTarget{}, fmt.Errorf("unsupported command for watch: %s (supported: resize, convert, strip)", name)
+	}
+
+	flags := target.cmd.Flags()
+	if err := flags.Parse(args); err != nil {
+		return watchTarget{}, err
+	}
+	if flags.NArg() > 0 {
+		return watchTarget{}, fmt.Errorf("watch supplies the input files; remove %s", strings.Join(flags.Args(), " "))
+	}
+	for _, unsupported := range []string{"output", "out-dir", "out-archive", "dry-run", "files-from", "report"} {
+		if flags.Changed(unsupported) {
+			return watchTarget{}, fmt.Errorf("--%s is not supported with watch", unsupported)
+		}
+	}
+
+	if err := target.batch.setup(nil); err != nil {
+		return watchTarget{}, err
+	}
+	return target, nil
+}
+
+// isWatchCandidate returns true for visible files with a supported image extension
+func isWatchCandidate(path string) bool {
+	name := filepath.Base(path)
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	ext := strings.TrimPrefix(filepath.Ext(name), ".")
+	return ext != "" && image.ValidateFormat(ext) == nil
+}
+
+// sameFile returns true if info shows a file unchanged since written
+func sameFile(info, written os.FileInfo) bool {
+	return info.Size() == written.Size() && info.ModTime().Equal(written.ModTime())
+}
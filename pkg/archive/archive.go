@@ -0,0 +1,258 @@
+// Package archive reads images from zip and tar archives, one archive in
+// memory at a time, and streams outputs into new archives
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/hiroki-abe-58/imgai/pkg/image"
+	"github.com/hiroki-abe-58/imgai/pkg/storage"
+)
+
+// Supported archive formats
+const (
+	Zip   = "zip"
+	Tar   = "tar"
+	TarGz = "tar.gz"
+)
+
+// ErrArchive is returned when an archive cannot be read or written
+var ErrArchive = errors.New("invalid archive")
+
+// ErrNoImages is returned when an archive contains no supported images
+var ErrNoImages = errors.New("archive contains no images")
+
+// Format returns the archive format of name from its extension, or "" if
+// name is not an archive
+func Format(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return Zip
+	case strings.HasSuffix(lower, ".tar"):
+		return Tar
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return TarGz
+	}
+	return ""
+}
+
+// IsArchive returns true if name has a supported archive extension
+func IsArchive(name string) bool {
+	return Format(name) != ""
+}
+
+// Limits bounds the archives a Reader mounts. Zero fields are unlimited.
+type Limits struct {
+	// MaxMemberSize bounds the size of each image in an archive
+	MaxMemberSize int64
+
+	// MaxTotalSize bounds the total size of the images in one archive,
+	// which are held in memory while the archive is processed
+	MaxTotalSize int64
+
+	// MaxMembers bounds the number of images in one archive
+	MaxMembers int
+}
+
+// DefaultLimits keep a hostile archive from exhausting memory
+var DefaultLimits = Limits{
+	MaxTotalSize: 1 << 30,
+	MaxMembers:   10000,
+}
+
+// member is an image read from an archive
+type member struct {
+	name string
+	data []byte
+}
+
+// visitFunc is called for each image in an archive with its cleaned name,
+// its declared size and a function opening its content
+type visitFunc func(name string, size int64, open func() (io.ReadCloser, error)) error
+
+// listMembers returns the names of the images in the archive at name on
+// fsys without keeping their content, checking them against limits
+func listMembers(fsys fs.FS, name string, limits Limits) ([]string, error) {
+	var names []string
+	var total int64
+	err := walk(fsys, name, func(member string, size int64, _ func() (io.ReadCloser, error)) error {
+		names = append(names, member)
+		total += size
+		return limits.check(name, member, size, total, len(names))
+	})
+	return names, err
+}
+
+// readMembers returns the images in the archive at name on fsys. Sizes are
+// checked while reading, as declared sizes may understate the content.
+func readMembers(fsys fs.FS, name string, limits Limits) ([]member, error) {
+	var members []member
+	var total int64
+	err := walk(fsys, name, func(entry string, size int64, open func() (io.ReadCloser, error)) error {
+		if err := limits.check(name, entry, size, total+size, len(members)+1); err != nil {
+			return err
+		}
+		r, err := open()
+		if err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrArchive, entry, err)
+		}
+		defer r.Close()
+
+		content, err := readLimited(r, limits.remaining(total))
+		if err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrArchive, entry, err)
+		}
+		total += int64(len(content))
+		if err := limits.check(name, entry, int64(len(content)), total, len(members)+1); err != nil {
+			return err
+		}
+		members = append(members, member{name: entry, data: content})
+		return nil
+	})
+	return members, err
+}
+
+// check returns a LimitError if an image of size bytes, bringing the
+// archive to total bytes and count images, exceeds l
+func (l Limits) check(archive, member string, size, total int64, count int) error {
+	switch {
+	case l.MaxMemberSize > 0 && size > l.MaxMemberSize:
+		return &image.LimitError{Path: member, Limit: "file size", Value: size, Max: l.MaxMemberSize}
+	case l.MaxTotalSize > 0 && total > l.MaxTotalSize:
+		return &image.LimitError{Path: archive, Limit: "archive size", Value: total, Max: l.MaxTotalSize}
+	case l.MaxMembers > 0 && count > l.MaxMembers:
+		return &image.LimitError{Path: archive, Limit: "archive images", Value: int64(count), Max: int64(l.MaxMembers)}
+	}
+	return nil
+}
+
+// walk calls visit for each image in the archive at name on fsys, in the
+// format given by its extension. Names are cleaned so that they cannot
+// escape the archive. Tar archives are streamed; zip archives are read in
+// place when the file supports random access.
+func walk(fsys fs.FS, name string, visit visitFunc) error {
+	file, err := storage.OpenFile(fsys, name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	add := func(member string, size int64, open func() (io.ReadCloser, error)) error {
+		member = path.Clean("/" + strings.ReplaceAll(member, `\`, "/"))[1:]
+		if !isImage(member) {
+			return nil
+		}
+		return visit(member, size, open)
+	}
+
+	switch format := Format(name); format {
+	case Zip:
+		r, size, err := readerAt(file)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrArchive, err)
+		}
+		zr, err := zip.NewReader(r, size)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrArchive, err)
+		}
+		for _, f := range zr.File {
+			if !f.Mode().IsRegular() {
+				continue
+			}
+			if err := add(f.Name, int64(f.UncompressedSize64), f.Open); err != nil {
+				return err
+			}
+		}
+	case Tar, TarGz:
+		var r io.Reader = file
+		if format == TarGz {
+			gz, err := gzip.NewReader(r)
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrArchive, err)
+			}
+			defer gz.Close()
+			r = gz
+		}
+		tr := tar.NewReader(r)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrArchive, err)
+			}
+			if header.Typeflag != tar.TypeReg {
+				continue
+			}
+			open := func() (io.ReadCloser, error) { return io.NopCloser(tr), nil }
+			if err := add(header.Name, header.Size, open); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%w: %s: unsupported extension", ErrArchive, name)
+	}
+	return nil
+}
+
+// readerAt returns random access to file and its size, reading it into
+// memory only when it does not support io.ReaderAt
+func readerAt(file fs.File) (io.ReaderAt, int64, error) {
+	if r, ok := file.(io.ReaderAt); ok {
+		info, err := file.Stat()
+		if err != nil {
+			return nil, 0, err
+		}
+		return r, info.Size(), nil
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bytes.NewReader(data), int64(len(data)), nil
+}
+
+// remaining returns the most bytes the next image may have once total
+// bytes were read, or -1 if it is unlimited
+func (l Limits) remaining(total int64) int64 {
+	n := int64(-1)
+	if l.MaxMemberSize > 0 {
+		n = l.MaxMemberSize
+	}
+	if l.MaxTotalSize > 0 && (n < 0 || l.MaxTotalSize-total < n) {
+		n = max(l.MaxTotalSize-total, 0)
+	}
+	return n
+}
+
+// readLimited reads r to the end, or to one byte past maxSize so that
+// oversized members are detected without reading them fully (a negative
+// maxSize means unlimited)
+func readLimited(r io.Reader, maxSize int64) ([]byte, error) {
+	if maxSize >= 0 {
+		r = io.LimitReader(r, maxSize+1)
+	}
+	return io.ReadAll(r)
+}
+
+// isImage returns true if name is an image with a supported extension,
+// skipping resource forks and other metadata added by archivers
+func isImage(name string) bool {
+	base := path.Base(name)
+	if strings.HasPrefix(base, "._") || strings.HasPrefix(name, "__MACOSX/") {
+		return false
+	}
+	ext := strings.TrimPrefix(path.Ext(base), ".")
+	return ext != "" && image.ValidateFormat(ext) == nil
+}
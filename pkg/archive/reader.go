@@ -0,0 +1,190 @@
+package archive
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/hiroki-abe-58/imgai/pkg/storage"
+)
+
+// Reader expands archives into the images they contain, named
+// "<archive>/<member>" after the archive they were mounted from.
+//
+// Mounting only lists an archive. Its images are read into an in-memory FS
+// by Load when the first of them is processed and dropped once Done was
+// called for all of them, so only the archives being processed take up
+// memory.
+type Reader struct {
+	base   fs.FS
+	limits Limits
+
+	mu     sync.RWMutex
+	mounts map[string]*mount
+	mem    *storage.MemFS
+}
+
+// mount is the state of a mounted archive
+type mount struct {
+	name  string
+	names []string
+
+	mu      sync.Mutex
+	pending int
+	loaded  bool
+	err     error
+}
+
+// NewReader returns a Reader for archives on base that mounts archives
+// within limits. A nil base means the local file system, with archives and
+// their images named by native paths.
+func NewReader(base fs.FS, limits Limits) *Reader {
+	return &Reader{
+		base:   base,
+		limits: limits,
+		mounts: make(map[string]*mount),
+		mem:    storage.NewMemFS(),
+	}
+}
+
+// FS returns the in-memory file system holding the images of loaded
+// archives under the names returned by Name. Files written to it are kept
+// until removed.
+func (r *Reader) FS() *storage.MemFS {
+	return r.mem
+}
+
+// Name returns the name of the image at path in FS
+func (r *Reader) Name(path string) string {
+	if r.base != nil {
+		return path
+	}
+	// Absolute names let relative and absolute paths of a file match
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return strings.TrimLeft(filepath.ToSlash(path), "/")
+}
+
+// Mount lists the archive at name on the base file system and returns the
+// names of the images it contains. Mounting an archive again returns the
+// same names without reading it, expecting each image to be processed
+// again.
+func (r *Reader) Mount(name string) ([]string, error) {
+	r.mu.RLock()
+	m, ok := r.mounts[r.Name(name)]
+	r.mu.RUnlock()
+	if ok {
+		m.mu.Lock()
+		m.pending = len(m.names)
+		m.mu.Unlock()
+		return m.names, nil
+	}
+
+	members, err := listMembers(r.base, name, r.limits)
+	if err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoImages, name)
+	}
+
+	names := make([]string, len(members))
+	for i, member := range members {
+		names[i] = r.join(name, member)
+	}
+	r.mu.Lock()
+	r.mounts[r.Name(name)] = &mount{name: name, names: names, pending: len(names)}
+	r.mu.Unlock()
+	return names, nil
+}
+
+// Load reads the images of the archive containing name into FS unless they
+// already are. It does nothing for names outside mounted archives.
+func (r *Reader) Load(name string) error {
+	m := r.mountOf(name)
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.loaded || m.err != nil {
+		return m.err
+	}
+
+	members, err := readMembers(r.base, m.name, r.limits)
+	if err != nil {
+		m.err = err
+		return err
+	}
+	for _, member := range members {
+		if err := r.mem.WriteFile(r.Name(r.join(m.name, member.name)), member.data, 0o644); err != nil {
+			m.err = fmt.Errorf("%w: %w", ErrArchive, err)
+			return m.err
+		}
+	}
+	m.loaded = true
+	return nil
+}
+
+// Done records that the image name has been processed. Once all images of
+// its archive are, they are dropped from FS.
+func (r *Reader) Done(name string) {
+	m := r.mountOf(name)
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pending > 0 {
+		m.pending--
+	}
+	if m.pending > 0 || !m.loaded {
+		return
+	}
+	for _, member := range m.names {
+		r.mem.Remove(r.Name(member))
+	}
+	m.loaded = false
+}
+
+// mountOf returns the mount of the archive containing name, or nil
+func (r *Reader) mountOf(name string) *mount {
+	archive, _, ok := r.Archive(name)
+	if !ok {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.mounts[r.Name(archive)]
+}
+
+// Archive returns the mounted archive containing name and the slash-separated
+// path of name inside it, or false if name is not below a mounted archive
+func (r *Reader) Archive(name string) (string, string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	k := r.Name(name)
+	for mount := range r.mounts {
+		if rel, ok := strings.CutPrefix(k, mount+"/"); ok {
+			// Recover the archive as it was named by the caller
+			if r.base != nil {
+				return mount, rel, true
+			}
+			archive := strings.TrimSuffix(filepath.ToSlash(filepath.Clean(name)), "/"+rel)
+			return filepath.FromSlash(archive), rel, true
+		}
+	}
+	return "", "", false
+}
+
+// join returns the name of member inside the archive at name
+func (r *Reader) join(name, member string) string {
+	if r.base != nil {
+		return path.Join(name, member)
+	}
+	return filepath.Join(name, filepath.FromSlash(member))
+}
@@ -0,0 +1,201 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hiroki-abe-58/imgai/pkg/storage"
+)
+
+// ErrExists is returned when a name is added to a Writer twice
+var ErrExists = errors.New("archive entry already exists")
+
+// Writer streams files added concurrently into an archive. Entries are
+// written to a temporary file as they are added, in the order they arrive,
+// and the archive replaces its destination on Commit.
+type Writer struct {
+	name   string
+	format string
+
+	mu    sync.Mutex
+	names map[string]bool
+	file  *os.File
+	zw    *zip.Writer
+	gz    *gzip.Writer
+	tw    *tar.Writer
+	err   error
+}
+
+// NewWriter returns a Writer for an archive named name, local or remote, in
+// the format given by its extension
+func NewWriter(name string) (*Writer, error) {
+	format := Format(name)
+	if format == "" {
+		return nil, fmt.Errorf("%w: %s: unsupported extension (supported: .zip, .tar, .tar.gz, .tgz)", ErrArchive, name)
+	}
+	return &Writer{name: name, format: format, names: make(map[string]bool)}, nil
+}
+
+// Add writes data as the entry with the slash-separated name and returns
+// the cleaned name. It fails with ErrExists if name was already added.
+func (w *Writer) Add(name string, data []byte) (string, error) {
+	name = path.Clean("/" + strings.ReplaceAll(name, `\`, "/"))[1:]
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.names[name] {
+		return "", fmt.Errorf("%w: %s", ErrExists, name)
+	}
+	if w.err != nil {
+		return "", w.err
+	}
+	if w.file == nil {
+		if w.err = w.start(); w.err != nil {
+			return "", w.err
+		}
+	}
+	if err := w.write(name, data); err != nil {
+		// The archive is corrupt past a failed entry
+		w.err = fmt.Errorf("%w: %w", ErrArchive, err)
+		return "", w.err
+	}
+	w.names[name] = true
+	return name, nil
+}
+
+// Len returns the number of entries added
+func (w *Writer) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.names)
+}
+
+// Commit finishes the archive and replaces its destination with it. Local
+// archives are renamed into place; remote ones are uploaded.
+func (w *Writer) Commit(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return w.err
+	}
+	defer w.discard()
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.finish(); err != nil {
+		return fmt.Errorf("%w: %w", ErrArchive, err)
+	}
+
+	if storage.IsRemote(w.name) {
+		data, err := os.ReadFile(w.file.Name())
+		if err != nil {
+			return err
+		}
+		return storage.WriteFile(ctx, w.name, data)
+	}
+	return os.Rename(w.file.Name(), w.name)
+}
+
+// Abort discards the archive, leaving its destination untouched
+func (w *Writer) Abort() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file != nil {
+		w.discard()
+	}
+}
+
+// start creates the temporary file, next to a local destination so that
+// Commit can rename it
+func (w *Writer) start() error {
+	dir := ""
+	if !storage.IsRemote(w.name) {
+		dir = filepath.Dir(w.name)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	file, err := os.CreateTemp(dir, ".imgai-*.tmp")
+	if err != nil {
+		return err
+	}
+	w.file = file
+	if err := file.Chmod(0o644); err != nil {
+		return err
+	}
+
+	if w.format == Zip {
+		w.zw = zip.NewWriter(file)
+		return nil
+	}
+	var out io.Writer = file
+	if w.format == TarGz {
+		w.gz = gzip.NewWriter(file)
+		out = w.gz
+	}
+	w.tw = tar.NewWriter(out)
+	return nil
+}
+
+// write appends one entry. Images are already compressed, so zip entries
+// are stored rather than deflated.
+func (w *Writer) write(name string, data []byte) error {
+	now := time.Now()
+	if w.zw != nil {
+		file, err := w.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: now})
+		if err != nil {
+			return err
+		}
+		_, err = file.Write(data)
+		return err
+	}
+
+	header := &tar.Header{
+		Name:     name,
+		Mode:     0o644,
+		Size:     int64(len(data)),
+		ModTime:  now,
+		Typeflag: tar.TypeReg,
+		Format:   tar.FormatPAX,
+	}
+	if err := w.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := w.tw.Write(data)
+	return err
+}
+
+// finish writes the archive trailer and closes the temporary file
+func (w *Writer) finish() error {
+	var err error
+	if w.zw != nil {
+		err = w.zw.Close()
+	} else {
+		err = w.tw.Close()
+		if w.gz != nil && err == nil {
+			err = w.gz.Close()
+		}
+	}
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// discard closes and removes the temporary file, if it is still there
+func (w *Writer) discard() {
+	w.file.Close()
+	os.Remove(w.file.Name())
+	w.file = nil
+}
@@ -0,0 +1,186 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Run records the original state of files modified by a single command invocation
+type Run struct {
+	ID string
+
+	op        string
+	dir       string
+	mu        sync.Mutex
+	journal   *os.File
+	protected map[string]bool
+	seq       int
+}
+
+// NewRun prepares a backup run under root for the given operation. Its
+// directory is only created once the first file is protected, so runs that
+// modify nothing leave no trace.
+func NewRun(root, op string) (*Run, error) {
+	if root == "" {
+		root = DefaultDir
+	}
+
+	id := newRunID()
+	return &Run{
+		ID:        id,
+		op:        op,
+		dir:       filepath.Join(root, id),
+		protected: make(map[string]bool),
+	}, nil
+}
+
+// open creates the run directory and journal
+func (r *Run) open() error {
+	if err := os.MkdirAll(filepath.Join(r.dir, filesDir), 0o755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	journal, err := os.OpenFile(filepath.Join(r.dir, journalFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create backup journal: %w", err)
+	}
+	r.journal = journal
+	return nil
+}
+
+// Protect saves a copy of path before it is modified.
+// If the file does not exist yet, the run records that it was created.
+func (r *Run) Protect(path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.protected[absPath] {
+		return nil
+	}
+	if r.journal == nil {
+		if err := r.open(); err != nil {
+			return err
+		}
+	}
+
+	entry := Entry{
+		Op:   r.op,
+		Path: absPath,
+		Time: time.Now(),
+	}
+
+	if _, err := os.Stat(absPath); os.IsNotExist(err) {
+		entry.Created = true
+	} else {
+		r.seq++
+		entry.Backup = filepath.Join(filesDir, strconv.Itoa(r.seq)+"_"+filepath.Base(absPath))
+		if err := copyFile(absPath, filepath.Join(r.dir, entry.Backup)); err != nil {
+			return fmt.Errorf("failed to back up %s: %w", path, err)
+		}
+	}
+
+	if err := r.writeEntry(entry); err != nil {
+		return err
+	}
+	r.protected[absPath] = true
+	return nil
+}
+
+// Empty returns true if the run has not protected any file
+func (r *Run) Empty() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.protected) == 0
+}
+
+// Close closes the run journal. A run that protected no file is removed.
+func (r *Run) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.journal == nil {
+		return nil
+	}
+	if err := r.journal.Close(); err != nil {
+		return err
+	}
+	if len(r.protected) == 0 {
+		return os.RemoveAll(r.dir)
+	}
+	return nil
+}
+
+// writeEntry appends an entry to the journal
+func (r *Run) writeEntry(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode journal entry: %w", err)
+	}
+	if _, err := r.journal.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal entry: %w", err)
+	}
+	return r.journal.Sync()
+}
+
+// runIDLayout is the time layout of run identifiers, followed by nanoseconds
+const runIDLayout = "20060102-150405"
+
+// newRunID returns a sortable, unique run identifier
+func newRunID() string {
+	now := time.Now()
+	return fmt.Sprintf("%s-%09d", now.Format(runIDLayout), now.Nanosecond())
+}
+
+// validRunID returns true if id has the form of a run identifier, e.g.
+// "20250101-120000-000000000", and so names no other path
+func validRunID(id string) bool {
+	n := len(runIDLayout)
+	if len(id) != n+1+9 || id[n] != '-' {
+		return false
+	}
+	if _, err := time.Parse(runIDLayout, id[:n]); err != nil {
+		return false
+	}
+	for _, c := range id[n+1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// copyFile copies src to dst, preserving the file mode
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
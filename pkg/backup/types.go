@@ -0,0 +1,29 @@
+package backup
+
+import "time"
+
+// DefaultDir is the directory where backups are stored
+const DefaultDir = ".imgai-backup"
+
+// journalFile is the name of the journal inside a run directory
+const journalFile = "journal.jsonl"
+
+// filesDir is the directory holding copies of original files inside a run directory
+const filesDir = "files"
+
+// Entry records a single file touched by a run
+type Entry struct {
+	Op      string    `json:"op"`
+	Path    string    `json:"path"`
+	Backup  string    `json:"backup,omitempty"`
+	Created bool      `json:"created,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// RunInfo summarizes a recorded run
+type RunInfo struct {
+	ID      string
+	Op      string
+	Files   int
+	Started time.Time
+}
@@ -0,0 +1,131 @@
+package backup
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ErrNoRuns is returned when there is nothing to undo
+var ErrNoRuns = errors.New("no backup runs found")
+
+// ErrUnknownRun is returned when undo is given an id that names no run
+var ErrUnknownRun = errors.New("unknown backup run")
+
+// ListRuns returns all recorded runs, oldest first
+func ListRuns(root string) ([]RunInfo, error) {
+	if root == "" {
+		root = DefaultDir
+	}
+
+	dirs, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var runs []RunInfo
+	for _, dir := range dirs {
+		if !dir.IsDir() || !validRunID(dir.Name()) {
+			continue
+		}
+		// Runs interrupted before recording a file have nothing to undo
+		entries, err := readJournal(filepath.Join(root, dir.Name()))
+		if err != nil || len(entries) == 0 {
+			continue
+		}
+		runs = append(runs, RunInfo{
+			ID:      dir.Name(),
+			Op:      entries[0].Op,
+			Files:   len(entries),
+			Started: entries[0].Time,
+		})
+	}
+
+	sort.Slice(runs, func(i, j int) bool { return runs[i].ID < runs[j].ID })
+	return runs, nil
+}
+
+// Undo restores files recorded by the run with the given id.
+// An empty id selects the most recent run. The run is removed once restored.
+func Undo(root, id string) ([]Entry, error) {
+	if root == "" {
+		root = DefaultDir
+	}
+
+	if id == "" {
+		runs, err := ListRuns(root)
+		if err != nil {
+			return nil, err
+		}
+		if len(runs) == 0 {
+			return nil, ErrNoRuns
+		}
+		id = runs[len(runs)-1].ID
+	} else if !validRunID(id) {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownRun, id)
+	}
+
+	dir := filepath.Join(root, id)
+	entries, err := readJournal(dir)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRun, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run %s: %w", id, err)
+	}
+
+	// Restore in reverse order so the earliest state wins
+	for i := len(entries) - 1; i >= 0; i-- {
+		if err := restoreEntry(dir, entries[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return entries, fmt.Errorf("restored files but failed to remove run %s: %w", id, err)
+	}
+	return entries, nil
+}
+
+// restoreEntry reverts a single journal entry
+func restoreEntry(dir string, entry Entry) error {
+	if entry.Created {
+		if err := os.Remove(entry.Path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", entry.Path, err)
+		}
+		return nil
+	}
+
+	if err := copyFile(filepath.Join(dir, entry.Backup), entry.Path); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", entry.Path, err)
+	}
+	return nil
+}
+
+// readJournal reads all entries from a run directory
+func readJournal(dir string) ([]Entry, error) {
+	file, err := os.Open(filepath.Join(dir, journalFile))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A torn final line means the run was interrupted mid-write
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
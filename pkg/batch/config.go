@@ -1,9 +1,64 @@
 package batch
 
+import (
+	"io/fs"
+	"time"
+
+	"github.com/hiroki-abe-58/imgai/pkg/archive"
+	"github.com/hiroki-abe-58/imgai/pkg/cache"
+)
+
 // Config holds configuration for batch processor
 type Config struct {
 	Workers      int
 	ShowProgress bool
+
+	// OnEvent receives structured progress events (optional)
+	OnEvent EventHandler
+
+	// OnResult receives results in input order while processing (optional)
+	OnResult func(Result)
+
+	// MaxMemory bounds the estimated memory of images decoded at once,
+	// in bytes (0 means unlimited)
+	MaxMemory int64
+
+	// MaxFailures stops dispatching new files once this many files have
+	// failed (0 means never stop)
+	MaxFailures int
+
+	// Retries is the number of extra attempts for transient I/O errors,
+	// waiting RetryBackoff before the first retry and doubling it after each
+	Retries      int
+	RetryBackoff time.Duration
+
+	// Timeout limits the time spent on a single file (0 means no limit)
+	Timeout time.Duration
+
+	// Journal records completed files; when loaded with resume, unchanged
+	// files that already succeeded are skipped
+	Journal *Journal
+
+	// JournalOptions is the OptionsHash of the operation, recorded with
+	// each journal entry
+	JournalOptions string
+
+	// Cache skips files whose output for the same content and options
+	// already exists and is current
+	Cache *cache.Store
+
+	// CacheOp and CacheOptions identify the operation in cache keys
+	CacheOp      string
+	CacheOptions interface{}
+
+	// FS holds the input files matched by patterns and fingerprinted for
+	// the journal and cache (nil means the local file system). The cache
+	// restores outputs only when it is also a storage.WriteFS.
+	FS fs.FS
+
+	// Archives, when set, expands local archive inputs into the images
+	// they contain
+	Archives *archive.Reader
 }
 
 // DefaultConfig returns the default configuration
@@ -11,6 +66,7 @@ func DefaultConfig() *Config {
 	return &Config{
 		Workers:      4,
 		ShowProgress: true,
+		RetryBackoff: 200 * time.Millisecond,
 	}
 }
 
@@ -0,0 +1,139 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// Event types emitted during processing
+const (
+	EventStart      = "start"
+	EventFileDone   = "file_done"
+	EventFileFailed = "file_failed"
+	// EventFileCanceled reports a file that was not processed because the
+	// run was interrupted or stopped after too many failures
+	EventFileCanceled = "file_canceled"
+	EventFinish       = "finish"
+)
+
+// Event describes a step in a batch run for progress reporting
+type Event struct {
+	Type      string    `json:"event"`
+	Time      time.Time `json:"time"`
+	ElapsedMS float64   `json:"elapsed_ms"`
+	Total     int       `json:"total"`
+	Completed int       `json:"completed"`
+	Succeeded int       `json:"succeeded"`
+	Failed    int       `json:"failed"`
+	Canceled  int       `json:"canceled"`
+
+	// File events
+	Path       string  `json:"path,omitempty"`
+	Output     string  `json:"output,omitempty"`
+	Skipped    bool    `json:"skipped,omitempty"`
+	DurationMS float64 `json:"duration_ms,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// EventHandler receives progress events. Calls are serialized by the processor.
+type EventHandler func(Event)
+
+// NewNDJSONHandler returns a handler that writes each event as a JSON line to w
+func NewNDJSONHandler(w io.Writer) EventHandler {
+	encoder := json.NewEncoder(w)
+	return func(event Event) {
+		encoder.Encode(event)
+	}
+}
+
+// eventEmitter tracks run progress and forwards events to a handler
+type eventEmitter struct {
+	mu        sync.Mutex
+	handler   EventHandler
+	start     time.Time
+	total     int
+	completed int
+	succeeded int
+	failed    int
+	canceled  int
+}
+
+// newEventEmitter creates an emitter; a nil handler disables events
+func newEventEmitter(handler EventHandler, total int) *eventEmitter {
+	return &eventEmitter{handler: handler, start: time.Now(), total: total}
+}
+
+// started emits the start event
+func (e *eventEmitter) started() {
+	e.emit(Event{Type: EventStart})
+}
+
+// fileFinished emits a file_done, file_failed or file_canceled event for
+// result
+func (e *eventEmitter) fileFinished(result Result) {
+	event := Event{
+		Path:       result.Path,
+		Output:     result.Output,
+		Skipped:    result.Skipped,
+		DurationMS: durationMS(result.Duration),
+	}
+	switch {
+	case result.Success:
+		event.Type = EventFileDone
+	case errors.Is(result.Error, context.Canceled) || errors.Is(result.Error, ErrAborted):
+		event.Type = EventFileCanceled
+		event.Error = result.Error.Error()
+	default:
+		event.Type = EventFileFailed
+		if result.Error != nil {
+			event.Error = result.Error.Error()
+		}
+	}
+	e.emit(event)
+}
+
+// finished emits the finish event
+func (e *eventEmitter) finished() {
+	e.emit(Event{Type: EventFinish})
+}
+
+// emit fills in progress counters and calls the handler
+func (e *eventEmitter) emit(event Event) {
+	if e.handler == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch event.Type {
+	case EventFileDone:
+		e.completed++
+		e.succeeded++
+	case EventFileFailed:
+		e.completed++
+		e.failed++
+	case EventFileCanceled:
+		e.completed++
+		e.canceled++
+	}
+
+	now := time.Now()
+	event.Time = now
+	event.ElapsedMS = durationMS(now.Sub(e.start))
+	event.Total = e.total
+	event.Completed = e.completed
+	event.Succeeded = e.succeeded
+	event.Failed = e.failed
+	event.Canceled = e.canceled
+	e.handler(event)
+}
+
+// durationMS converts a duration to fractional milliseconds
+func durationMS(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
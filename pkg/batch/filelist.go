@@ -0,0 +1,44 @@
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+)
+
+// ReadFileList reads file paths from r, one per line or, when null is set,
+// separated by NUL bytes as written by find -print0. Empty entries are skipped.
+func ReadFileList(r io.Reader, null bool) ([]string, error) {
+	sep := byte('\n')
+	if null {
+		sep = 0
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, sep); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+
+	var files []string
+	for scanner.Scan() {
+		path := scanner.Text()
+		if !null {
+			path = strings.TrimSuffix(path, "\r")
+		}
+		if path != "" {
+			files = append(files, path)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
@@ -0,0 +1,251 @@
+package batch
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hiroki-abe-58/imgai/pkg/storage"
+)
+
+// Fingerprint identifies the content of a file at a point in time
+type Fingerprint struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Hash    string    `json:"sha256"`
+}
+
+// JournalEntry records the outcome of processing a single file
+type JournalEntry struct {
+	Path        string      `json:"path"`
+	Options     string      `json:"options,omitempty"`
+	Fingerprint Fingerprint `json:"fingerprint"`
+	Success     bool        `json:"success"`
+	Error       string      `json:"error,omitempty"`
+	Time        time.Time   `json:"time"`
+}
+
+// Journal is an append-only checkpoint log of completed files
+type Journal struct {
+	mu        sync.Mutex
+	file      *os.File
+	completed map[string]JournalEntry
+
+	// options identifies the operation and options files are processed
+	// with; only files completed with the same options are skipped
+	options string
+
+	// fsys holds the journaled input files; the journal itself is always
+	// a local file
+	fsys fs.FS
+}
+
+// OpenJournal opens a checkpoint journal at path.
+// When resume is true, entries from a previous run are loaded and kept;
+// otherwise the journal is truncated.
+func OpenJournal(path string, resume bool) (*Journal, error) {
+	j := &Journal{completed: make(map[string]JournalEntry)}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	var end int64
+	if resume {
+		var err error
+		if end, err = j.load(path); err != nil {
+			return nil, err
+		}
+	} else {
+		flags |= os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	// Drop a line torn by a crash so that the next entry starts on a line
+	// of its own
+	if resume {
+		if err := file.Truncate(end); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to open journal: %w", err)
+		}
+	}
+	j.file = file
+	return j, nil
+}
+
+// Completed reports whether path was processed successfully in a previous run
+// and is unchanged since
+func (j *Journal) Completed(path string) bool {
+	j.mu.Lock()
+	entry, ok := j.completed[path]
+	ok = ok && entry.Options == j.options
+	j.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	recorded := entry.Fingerprint
+	info, err := storage.StatFile(j.fsys, path)
+	if err != nil || info.Size() != recorded.Size || !info.ModTime().Equal(recorded.ModTime) {
+		return false
+	}
+
+	current, err := FingerprintFile(j.fsys, path)
+	if err != nil {
+		return false
+	}
+	return current.Hash == recorded.Hash
+}
+
+// Record appends the outcome of processing a file to the journal
+func (j *Journal) Record(result Result) error {
+	j.mu.Lock()
+	options := j.options
+	j.mu.Unlock()
+
+	entry := JournalEntry{
+		Path:    result.Path,
+		Options: options,
+		Success: result.Success,
+		Time:    time.Now(),
+	}
+	if result.Error != nil {
+		entry.Error = result.Error.Error()
+	}
+
+	// Fingerprint after processing so in-place edits are recognized on
+	// resume. Remote inputs cannot be fingerprinted and are always redone.
+	if result.Success && !storage.IsRemote(result.Path) {
+		fp, err := FingerprintFile(j.fsys, result.Path)
+		if err != nil {
+			return fmt.Errorf("failed to fingerprint %s: %w", result.Path, err)
+		}
+		entry.Fingerprint = fp
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode journal entry: %w", err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal entry: %w", err)
+	}
+	// Sync each entry so that a crash loses at most the file in flight
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync journal: %w", err)
+	}
+	if entry.Success {
+		j.completed[entry.Path] = entry
+	} else {
+		delete(j.completed, entry.Path)
+	}
+	return nil
+}
+
+// SetOptions sets the hash of the operation and options files are
+// processed with. Files completed under other options, including entries
+// written without options, are processed again.
+func (j *Journal) SetOptions(options string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.options = options
+}
+
+// SetFS sets the file system holding the journaled input files
+// (nil means the local file system)
+func (j *Journal) SetFS(fsys fs.FS) {
+	j.fsys = fsys
+}
+
+// Close closes the journal
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+// load reads entries from an existing journal, if any, and returns the
+// offset just past its last complete line
+func (j *Journal) load(path string) (int64, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read journal: %w", err)
+	}
+	defer file.Close()
+
+	var end int64
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// A torn final line is expected after a crash
+			return end, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read journal: %w", err)
+		}
+		end += int64(len(line))
+
+		var entry JournalEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			continue
+		}
+		if entry.Success {
+			j.completed[entry.Path] = entry
+		} else {
+			delete(j.completed, entry.Path)
+		}
+	}
+}
+
+// OptionsHash returns the hash identifying op and options in journal
+// entries
+func OptionsHash(op string, options interface{}) (string, error) {
+	encoded, err := json.Marshal(options)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize journal options: %w", err)
+	}
+	hash := sha256.New()
+	hash.Write([]byte(op))
+	hash.Write([]byte{0})
+	hash.Write(encoded)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// FingerprintFile computes the size, modification time and SHA-256 of a file
+// on fsys (nil means the local file system)
+func FingerprintFile(fsys fs.FS, path string) (Fingerprint, error) {
+	file, err := storage.OpenFile(fsys, path)
+	if err != nil {
+		return Fingerprint{}, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return Fingerprint{}, err
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return Fingerprint{}, err
+	}
+
+	return Fingerprint{
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Hash:    hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
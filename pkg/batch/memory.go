@@ -0,0 +1,103 @@
+package batch
+
+import (
+	"context"
+	"image/color"
+	"io/fs"
+	"sync"
+
+	"github.com/hiroki-abe-58/imgai/pkg/image"
+)
+
+// workingBytesPerPixel accounts for the NRGBA copy made while transforming
+const workingBytesPerPixel = 4
+
+// memoryBudget admits work in FIFO order while the sum of reserved
+// estimates stays within limit
+type memoryBudget struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	limit   int64
+	used    int64
+	next    uint64
+	serving uint64
+}
+
+// newMemoryBudget creates a budget of limit bytes
+func newMemoryBudget(limit int64) *memoryBudget {
+	b := &memoryBudget{limit: limit}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// acquire blocks until n bytes can be reserved and returns the amount
+// reserved. Requests larger than the whole budget reserve all of it, so
+// outliers run on their own. It returns an error if ctx is done first;
+// all callers share the processor context, so an abandoned place in line
+// only ever blocks callers that are themselves giving up.
+func (b *memoryBudget) acquire(ctx context.Context, n int64) (int64, error) {
+	if n > b.limit {
+		n = b.limit
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		b.mu.Lock()
+		b.cond.Broadcast()
+		b.mu.Unlock()
+	})
+	defer stop()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ticket := b.next
+	b.next++
+	for ticket != b.serving || b.used+n > b.limit {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		b.cond.Wait()
+	}
+
+	b.serving++
+	b.used += n
+	b.cond.Broadcast()
+	return n, nil
+}
+
+// release returns n reserved bytes to the budget
+func (b *memoryBudget) release(n int64) {
+	b.mu.Lock()
+	b.used -= n
+	b.cond.Broadcast()
+	b.mu.Unlock()
+}
+
+// estimateMemory estimates the bytes needed to decode and transform the
+// image at path by reading only its header. Unreadable files estimate to 0.
+func estimateMemory(fsys fs.FS, path string) int64 {
+	cfg, _, err := image.DecodeConfigFile(fsys, path)
+	if err != nil {
+		return 0
+	}
+
+	pixels := int64(cfg.Width) * int64(cfg.Height)
+	return pixels * (bytesPerPixel(cfg.ColorModel) + workingBytesPerPixel)
+}
+
+// bytesPerPixel returns the in-memory size of a decoded pixel for a color model
+func bytesPerPixel(model color.Model) int64 {
+	switch model {
+	case color.GrayModel, color.AlphaModel:
+		return 1
+	case color.Gray16Model, color.Alpha16Model:
+		return 2
+	case color.RGBA64Model, color.NRGBA64Model:
+		return 8
+	case color.YCbCrModel, color.NYCbCrAModel:
+		// Upper bound for 4:4:4 chroma subsampling (plus alpha)
+		return 4
+	default:
+		return 4
+	}
+}
@@ -1,21 +1,49 @@
 package batch
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/hiroki-abe-58/imgai/pkg/archive"
+	"github.com/hiroki-abe-58/imgai/pkg/cache"
+	"github.com/hiroki-abe-58/imgai/pkg/remote"
+	"github.com/hiroki-abe-58/imgai/pkg/storage"
 	"github.com/schollz/progressbar/v3"
 )
 
-// ProcessFunc is a function type for processing a single file
-type ProcessFunc func(path string) error
+// ProcessFunc is a function type for processing a single file.
+// It returns the path of the written output, if any. Implementations should
+// stop and discard partial output when ctx is done.
+type ProcessFunc func(ctx context.Context, path string) (string, error)
 
 // Result holds the result of processing a file
 type Result struct {
-	Path    string
-	Success bool
-	Error   error
+	Path     string
+	Output   string
+	Success  bool
+	Skipped  bool
+	Error    error
+	Duration time.Duration
+}
+
+// job is a file queued for a worker with its estimated memory need
+type job struct {
+	index    int
+	path     string
+	estimate int64
+}
+
+// indexedResult is a result tagged with the input position of its file
+type indexedResult struct {
+	index  int
+	result Result
 }
 
 // Processor handles batch processing of files
@@ -45,10 +73,101 @@ func (p *Processor) SetProgressBar(show bool) {
 	p.config.ShowProgress = show
 }
 
-// Process processes multiple files concurrently
-func (p *Processor) Process(patterns []string, processFunc ProcessFunc) []Result {
+// SetEventHandler sets a callback for structured progress events
+func (p *Processor) SetEventHandler(handler EventHandler) {
+	p.config.OnEvent = handler
+}
+
+// SetResultHandler sets a callback that receives each result in input
+// order as soon as all earlier files have finished
+func (p *Processor) SetResultHandler(handler func(Result)) {
+	p.config.OnResult = handler
+}
+
+// SetJournal sets the checkpoint journal used to record and resume runs.
+// The journal fingerprints inputs on the processor's FS.
+func (p *Processor) SetJournal(journal *Journal) {
+	p.config.Journal = journal
+	if journal != nil {
+		journal.SetFS(p.config.FS)
+		journal.SetOptions(p.config.JournalOptions)
+	}
+}
+
+// SetOperation identifies the operation run on each file by op and
+// options, so that resuming from the journal with other options processes
+// files again
+func (p *Processor) SetOperation(op string, options interface{}) error {
+	hash, err := OptionsHash(op, options)
+	if err != nil {
+		return err
+	}
+	p.config.JournalOptions = hash
+	if p.config.Journal != nil {
+		p.config.Journal.SetOptions(hash)
+	}
+	return nil
+}
+
+// SetFS sets the file system holding the input files, with patterns and
+// paths as fs.Glob and fs.ValidPath take them (nil means the local file
+// system and native paths). ProcessFuncs are responsible for using the
+// same FS.
+func (p *Processor) SetFS(fsys fs.FS) {
+	p.config.FS = fsys
+	if p.config.Journal != nil {
+		p.config.Journal.SetFS(fsys)
+	}
+}
+
+// SetArchives makes local zip and tar inputs expand into the images they
+// contain, which archives loads into memory while they are processed.
+// ProcessFuncs must read the members from archives.FS.
+func (p *Processor) SetArchives(archives *archive.Reader) {
+	p.config.Archives = archives
+}
+
+// SetCache sets the incremental processing cache. op and options identify
+// the operation so that changing any option invalidates cached outputs.
+func (p *Processor) SetCache(store *cache.Store, op string, options interface{}) {
+	p.config.Cache = store
+	p.config.CacheOp = op
+	p.config.CacheOptions = options
+}
+
+// SetMaxMemory sets the memory budget in bytes for concurrently decoded
+// images (0 means unlimited)
+func (p *Processor) SetMaxMemory(limit int64) {
+	p.config.MaxMemory = limit
+}
+
+// SetMaxFailures stops dispatching new files after n failures (0 means never)
+func (p *Processor) SetMaxFailures(n int) {
+	p.config.MaxFailures = n
+}
+
+// SetRetry sets how many times transient I/O errors are retried and the
+// initial backoff between attempts
+func (p *Processor) SetRetry(retries int, backoff time.Duration) {
+	p.config.Retries = retries
+	if backoff > 0 {
+		p.config.RetryBackoff = backoff
+	}
+}
+
+// SetTimeout sets the maximum time allowed for processing a single file
+func (p *Processor) SetTimeout(timeout time.Duration) {
+	p.config.Timeout = timeout
+}
+
+// Process processes multiple files concurrently and returns their results
+// in input order.
+// When ctx is canceled or the failure threshold is reached no further files
+// are started; files that were never started are reported with the context
+// error or ErrAborted.
+func (p *Processor) Process(ctx context.Context, patterns []string, processFunc ProcessFunc) []Result {
 	// Expand patterns to file paths
-	files, err := expandPatterns(patterns)
+	files, err := expandPatterns(ctx, p.config.FS, patterns)
 	if err != nil {
 		return []Result{{
 			Path:    patterns[0],
@@ -65,6 +184,14 @@ func (p *Processor) Process(patterns []string, processFunc ProcessFunc) []Result
 		}}
 	}
 
+	return p.ProcessFiles(ctx, files, processFunc)
+}
+
+// ProcessFiles processes the given file paths as-is, without glob expansion,
+// and returns their results in input order. It behaves like Process otherwise.
+func (p *Processor) ProcessFiles(ctx context.Context, files []string, processFunc ProcessFunc) []Result {
+	files, failed := p.expandArchives(files)
+
 	// Create progress bar if enabled
 	var bar *progressbar.ProgressBar
 	if p.config.ShowProgress && len(files) > 1 {
@@ -72,7 +199,7 @@ func (p *Processor) Process(patterns []string, processFunc ProcessFunc) []Result
 	}
 
 	// Process files concurrently
-	results := p.processFiles(files, processFunc, bar)
+	results := p.processFiles(ctx, files, failed, processFunc, bar)
 
 	if bar != nil {
 		fmt.Println() // New line after progress bar
@@ -81,53 +208,268 @@ func (p *Processor) Process(patterns []string, processFunc ProcessFunc) []Result
 	return results
 }
 
-// processFiles processes files using worker pool pattern
-func (p *Processor) processFiles(files []string, processFunc ProcessFunc, bar *progressbar.ProgressBar) []Result {
-	jobs := make(chan string, len(files))
-	results := make(chan Result, len(files))
+// run holds the state shared by workers during a single Process call
+type run struct {
+	ctx         context.Context
+	dispatch    context.Context
+	abort       context.CancelCauseFunc
+	processFunc ProcessFunc
+	failed      map[string]error
+	budget      *memoryBudget
+	bar         *progressbar.ProgressBar
+	events      *eventEmitter
+	failures    atomic.Int64
+}
+
+// processFiles processes files using worker pool pattern. Files in failed
+// are reported with their error without being processed.
+func (p *Processor) processFiles(ctx context.Context, files []string, failed map[string]error, processFunc ProcessFunc, bar *progressbar.ProgressBar) []Result {
+	jobs := make(chan job)
+	results := make(chan indexedResult, len(files))
+
+	// dispatch is canceled to stop starting new files while letting
+	// in-flight files finish
+	dispatch, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+
+	r := &run{
+		ctx:         ctx,
+		dispatch:    dispatch,
+		abort:       abort,
+		processFunc: processFunc,
+		failed:      failed,
+		bar:         bar,
+		events:      newEventEmitter(p.config.OnEvent, len(files)),
+	}
+
+	// Read image headers up front to schedule within the memory budget
+	estimates := make([]int64, len(files))
+	if p.config.MaxMemory > 0 {
+		r.budget = newMemoryBudget(p.config.MaxMemory)
+		for i, file := range files {
+			estimates[i] = estimateMemory(p.config.FS, file)
+		}
+	}
 
 	// Start worker goroutines
+	r.events.started()
 	var wg sync.WaitGroup
 	for i := 0; i < p.config.Workers; i++ {
 		wg.Add(1)
-		go p.worker(&wg, jobs, results, processFunc, bar)
+		go p.worker(r, &wg, jobs, results)
 	}
 
-	// Send jobs to workers
-	for _, file := range files {
-		jobs <- file
+	// Send jobs to workers until canceled or aborted
+	sent := 0
+dispatchLoop:
+	for i, file := range files {
+		select {
+		case <-dispatch.Done():
+			break dispatchLoop
+		case jobs <- job{index: i, path: file, estimate: estimates[i]}:
+			sent++
+		}
 	}
 	close(jobs)
 
+	// Report files that were never started
+	for i := sent; i < len(files); i++ {
+		result := Result{Path: files[i], Error: context.Cause(dispatch)}
+		r.events.fileFinished(result)
+		results <- indexedResult{index: i, result: result}
+	}
+
 	// Wait for all workers to finish
 	go func() {
 		wg.Wait()
 		close(results)
 	}()
 
-	// Collect results
-	var allResults []Result
-	for result := range results {
-		allResults = append(allResults, result)
+	// Collect results in input order, streaming them as each prefix completes
+	allResults := make([]Result, len(files))
+	done := make([]bool, len(files))
+	next := 0
+	for indexed := range results {
+		allResults[indexed.index] = indexed.result
+		done[indexed.index] = true
+		for next < len(files) && done[next] {
+			if p.config.OnResult != nil {
+				p.config.OnResult(allResults[next])
+			}
+			next++
+		}
 	}
+	r.events.finished()
 
 	return allResults
 }
 
 // worker processes jobs from the jobs channel
-func (p *Processor) worker(wg *sync.WaitGroup, jobs <-chan string, results chan<- Result, processFunc ProcessFunc, bar *progressbar.ProgressBar) {
+func (p *Processor) worker(r *run, wg *sync.WaitGroup, jobs <-chan job, results chan<- indexedResult) {
 	defer wg.Done()
-	for path := range jobs {
-		err := processFunc(path)
-		results <- Result{
-			Path:    path,
-			Success: err == nil,
-			Error:   err,
+	for j := range jobs {
+		result := p.processJob(r, j)
+		r.events.fileFinished(result)
+		p.countFailure(r, result)
+		results <- indexedResult{index: j.index, result: result}
+		if r.bar != nil {
+			r.bar.Add(1)
 		}
-		if bar != nil {
-			bar.Add(1)
+	}
+}
+
+// countFailure aborts dispatching once the failure threshold is reached
+func (p *Processor) countFailure(r *run, result Result) {
+	if result.Success || p.config.MaxFailures <= 0 {
+		return
+	}
+	if errors.Is(result.Error, context.Canceled) || errors.Is(result.Error, ErrAborted) {
+		return
+	}
+	if r.failures.Add(1) >= int64(p.config.MaxFailures) {
+		r.abort(ErrAborted)
+	}
+}
+
+// processJob processes a job once its memory estimate fits in the budget
+func (p *Processor) processJob(r *run, j job) Result {
+	if err := context.Cause(r.dispatch); err != nil {
+		return Result{Path: j.path, Error: err}
+	}
+	if err := r.failed[j.path]; err != nil {
+		return Result{Path: j.path, Error: err}
+	}
+	// Archives are read into memory when their first image is processed
+	// and dropped after their last
+	if archives := p.config.Archives; archives != nil {
+		defer archives.Done(j.path)
+		if err := archives.Load(j.path); err != nil {
+			return Result{Path: j.path, Error: err}
 		}
 	}
+	if r.budget == nil || j.estimate == 0 {
+		return p.processFile(r.ctx, j.path, r.processFunc)
+	}
+
+	reserved, err := r.budget.acquire(r.dispatch, j.estimate)
+	if err != nil {
+		return Result{Path: j.path, Error: context.Cause(r.dispatch)}
+	}
+	defer r.budget.release(reserved)
+
+	return p.processFile(r.ctx, j.path, r.processFunc)
+}
+
+// processFile processes a single file, consulting and updating the journal
+func (p *Processor) processFile(ctx context.Context, path string, processFunc ProcessFunc) (result Result) {
+	start := time.Now()
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
+
+	if err := ctx.Err(); err != nil {
+		return Result{Path: path, Error: err}
+	}
+
+	journal := p.config.Journal
+	if journal != nil && journal.Completed(path) {
+		return Result{Path: path, Success: true, Skipped: true}
+	}
+
+	cacheKey, variantKey, cached := p.lookupCache(path)
+	if cached != nil {
+		result = Result{Path: path, Output: cached.Output, Success: true, Skipped: true}
+		if journal != nil {
+			journal.Record(result)
+		}
+		return result
+	}
+
+	output, err := p.runWithRetry(ctx, path, processFunc)
+	result = Result{
+		Path:    path,
+		Output:  output,
+		Success: err == nil,
+		Error:   err,
+	}
+
+	// In-place operations replace their input, which the next run then
+	// fingerprints, so their entry is keyed on the output content instead
+	if result.Success && cacheKey != "" && output == path {
+		cacheKey, _ = p.cacheKeys(path)
+		variantKey = ""
+	}
+
+	// Only local outputs can be checked for changes later
+	if result.Success && cacheKey != "" && output != "" && !storage.IsRemote(output) {
+		if cerr := p.config.Cache.Put(p.config.FS, cacheKey, variantKey, path, output); cerr != nil {
+			result.Success = false
+			result.Error = cerr
+		}
+	}
+
+	// Interrupted files are retried on resume, so they are not journaled
+	if journal != nil && !errors.Is(result.Error, context.Canceled) {
+		if jerr := journal.Record(result); jerr != nil && result.Error == nil {
+			result.Success = false
+			result.Error = jerr
+		}
+	}
+	return result
+}
+
+// runWithTimeout runs processFunc with the configured per-file timeout
+func (p *Processor) runWithTimeout(ctx context.Context, path string, processFunc ProcessFunc) (string, error) {
+	if p.config.Timeout <= 0 {
+		return processFunc(ctx, path)
+	}
+
+	fileCtx, cancel := context.WithTimeout(ctx, p.config.Timeout)
+	defer cancel()
+
+	output, err := processFunc(fileCtx, path)
+	if err != nil && ctx.Err() == nil && errors.Is(fileCtx.Err(), context.DeadlineExceeded) {
+		return output, fmt.Errorf("timed out after %s: %w", p.config.Timeout, err)
+	}
+	return output, err
+}
+
+// lookupCache computes the cache and variant keys for path and returns the
+// cached entry if its output is still current or could be restored. The
+// keys are empty when caching is disabled.
+func (p *Processor) lookupCache(path string) (string, string, *cache.Entry) {
+	if p.config.Cache == nil {
+		return "", "", nil
+	}
+
+	key, variant := p.cacheKeys(path)
+	if key == "" {
+		return "", "", nil
+	}
+	if entry, ok := p.config.Cache.Lookup(p.config.FS, key); ok {
+		return key, variant, entry
+	}
+	return key, variant, nil
+}
+
+// cacheKeys returns the cache and variant keys for the current content of
+// path, or empty keys if it cannot be fingerprinted
+func (p *Processor) cacheKeys(path string) (string, string) {
+	fp, err := FingerprintFile(p.config.FS, path)
+	if err != nil {
+		return "", ""
+	}
+	key, err := cache.Key(path, fp.Hash, p.config.CacheOp, p.config.CacheOptions)
+	if err != nil {
+		return "", ""
+	}
+	// Some operations derive the output format from the input extension
+	ext := strings.ToLower(filepath.Ext(path))
+	variant, err := cache.VariantKey(fp.Hash, p.config.CacheOp, []interface{}{ext, p.config.CacheOptions})
+	if err != nil {
+		return "", ""
+	}
+	return key, variant
 }
 
 // createProgressBar creates a configured progress bar
@@ -147,13 +489,58 @@ func createProgressBar(total int) *progressbar.ProgressBar {
 	)
 }
 
-// expandPatterns expands glob patterns to actual file paths
-func expandPatterns(patterns []string) ([]string, error) {
+// expandArchives replaces archive inputs with the images they contain when
+// archives are enabled. Archives that cannot be read stay in the list and
+// are returned in failed with their error.
+func (p *Processor) expandArchives(files []string) ([]string, map[string]error) {
+	if p.config.Archives == nil {
+		return files, nil
+	}
+
+	var expanded []string
+	failed := make(map[string]error)
+	for _, file := range files {
+		if !archive.IsArchive(file) || storage.IsRemote(file) {
+			expanded = append(expanded, file)
+			continue
+		}
+		members, err := p.config.Archives.Mount(file)
+		if err != nil {
+			failed[file] = err
+			expanded = append(expanded, file)
+			continue
+		}
+		expanded = append(expanded, members...)
+	}
+	return expanded, failed
+}
+
+// expandPatterns expands glob patterns to actual file paths, on fsys for
+// local patterns and on the registered storage backend for remote ones
+func expandPatterns(ctx context.Context, fsys fs.FS, patterns []string) ([]string, error) {
 	var files []string
 	seen := make(map[string]bool)
 
 	for _, pattern := range patterns {
-		matches, err := filepath.Glob(pattern)
+		// URLs are fetched by the ProcessFunc, not matched on disk
+		if remote.IsURL(pattern) {
+			if !seen[pattern] {
+				files = append(files, pattern)
+				seen[pattern] = true
+			}
+			continue
+		}
+
+		var matches []string
+		var err error
+		switch {
+		case storage.IsRemote(pattern):
+			matches, err = storage.Glob(ctx, pattern)
+		case fsys == nil:
+			matches, err = filepath.Glob(pattern)
+		default:
+			matches, err = fs.Glob(fsys, pattern)
+		}
 		if err != nil {
 			return nil, err
 		}
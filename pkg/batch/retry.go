@@ -0,0 +1,62 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/hiroki-abe-58/imgai/pkg/storage"
+)
+
+// ErrAborted is returned for files that were not started because the
+// failure threshold was reached
+var ErrAborted = errors.New("batch aborted after too many failures")
+
+// transientErrnos are system errors that may succeed when retried
+var transientErrnos = []syscall.Errno{
+	syscall.EAGAIN,
+	syscall.EINTR,
+	syscall.EBUSY,
+	syscall.ETIMEDOUT,
+	syscall.ECONNRESET,
+}
+
+// IsTransient reports whether err is a temporary I/O error worth retrying
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, errno := range transientErrnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, storage.ErrUnavailable) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// runWithRetry runs processFunc, retrying transient errors with exponential backoff
+func (p *Processor) runWithRetry(ctx context.Context, path string, processFunc ProcessFunc) (string, error) {
+	backoff := p.config.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		output, err := p.runWithTimeout(ctx, path, processFunc)
+		if err == nil || attempt >= p.config.Retries || !IsTransient(err) {
+			return output, err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return output, err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,336 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hiroki-abe-58/imgai/pkg/storage"
+)
+
+// DefaultDir is the default directory for the processing cache
+const DefaultDir = ".imgai-cache"
+
+// DefaultMaxSize is the default bound on stored encoded outputs
+const DefaultMaxSize = 1 << 30
+
+// tagFile marks a directory as a cache, following the Cache Directory
+// Tagging Specification so that backup tools skip it
+const tagFile = "CACHEDIR.TAG"
+
+// tagContent is written to tagFile; the signature line is fixed by the spec
+const tagContent = "Signature: 8a477f597d28d172789f06886806bc55\n" +
+	"# This file is a cache directory tag created by imgai.\n" +
+	"# For information about cache directory tags see https://bford.info/cachedir/\n"
+
+// ErrNotCache is returned when a directory exists but is not a cache store
+var ErrNotCache = errors.New("not an imgai cache directory")
+
+// Entry records the output produced for a given input and options
+type Entry struct {
+	Input         string    `json:"input"`
+	Output        string    `json:"output"`
+	OutputSize    int64     `json:"output_size"`
+	OutputModTime time.Time `json:"output_mtime"`
+	Created       time.Time `json:"created"`
+
+	// Variant is the key of the stored copy of the output, if any
+	Variant string `json:"variant,omitempty"`
+}
+
+// Store is a persistent, directory-backed cache of processing results.
+// Besides records of produced outputs it keeps copies of encoded outputs
+// (variants), bounded in total size by evicting the least recently used.
+type Store struct {
+	dir     string
+	maxSize int64
+
+	mu   sync.Mutex
+	size int64
+
+	// pruneMu serializes evictions so that concurrent puts do not all scan
+	// the store at once
+	pruneMu sync.Mutex
+}
+
+// Open opens (and creates if needed) a cache store rooted at dir, keeping
+// stored variants within DefaultMaxSize. A new store is marked with a
+// CACHEDIR.TAG file; an existing directory must be empty or already hold a
+// store, so that a mistyped path never gets cache files mixed into it.
+func Open(dir string) (*Store, error) {
+	if dir == "" {
+		dir = DefaultDir
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	if !hasTag(dir) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cache directory: %w", err)
+		}
+		if len(entries) > 0 {
+			return nil, fmt.Errorf("%w: %s is not empty and has no %s", ErrNotCache, dir, tagFile)
+		}
+	}
+	if err := writeTag(dir); err != nil {
+		return nil, err
+	}
+	return open(dir)
+}
+
+// OpenExisting opens the cache store at dir without creating anything. It
+// fails with ErrNotCache unless dir is marked as a store, so that
+// maintenance such as Clear is never run on an unrelated directory.
+func OpenExisting(dir string) (*Store, error) {
+	if _, err := os.Stat(filepath.Join(dir, tagFile)); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s has no %s", ErrNotCache, dir, tagFile)
+		}
+		return nil, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+	return open(dir)
+}
+
+// open opens the store at dir and totals the size of its variants
+func open(dir string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Join(dir, variantsDir), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	s := &Store{dir: dir, maxSize: DefaultMaxSize}
+	variants, err := s.variants()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range variants {
+		s.size += v.size
+	}
+	return s, nil
+}
+
+// hasTag returns true if dir is marked as a cache store
+func hasTag(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, tagFile))
+	return err == nil
+}
+
+// writeTag marks dir as a cache store unless it already is
+func writeTag(dir string) error {
+	if hasTag(dir) {
+		return nil
+	}
+	if err := writeFileAtomic(filepath.Join(dir, tagFile), []byte(tagContent)); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return nil
+}
+
+// SetMaxSize bounds the total size of stored variants (0 disables storing them)
+func (s *Store) SetMaxSize(n int64) {
+	s.mu.Lock()
+	s.maxSize = n
+	s.mu.Unlock()
+}
+
+// Key derives a cache key from the input path and content hash, the operation
+// name and its options. The path is included because output names are derived
+// from it. Options must be JSON-serializable.
+func Key(input, inputHash, op string, options interface{}) (string, error) {
+	return key(filepath.Clean(input), inputHash, op, options)
+}
+
+// VariantKey derives the key of an encoded output from the input content
+// hash, the operation name and its normalized options. Unlike Key it does
+// not depend on the input path, so identical inputs share stored outputs.
+func VariantKey(inputHash, op string, options interface{}) (string, error) {
+	return key("", inputHash, op, options)
+}
+
+// key hashes the NUL-separated parts of a cache key
+func key(input, inputHash, op string, options interface{}) (string, error) {
+	encoded, err := json.Marshal(options)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize cache options: %w", err)
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(input))
+	hash.Write([]byte{0})
+	hash.Write([]byte(inputHash))
+	hash.Write([]byte{0})
+	hash.Write([]byte(op))
+	hash.Write([]byte{0})
+	hash.Write(encoded)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Lookup returns the entry for key if its output still exists unchanged on
+// fsys (nil means the local file system). A missing output is restored from
+// its stored variant when one is kept.
+func (s *Store) Lookup(fsys fs.FS, key string) (*Entry, bool) {
+	entry, err := s.readEntry(key)
+	if err != nil {
+		return nil, false
+	}
+
+	info, err := storage.StatFile(fsys, entry.Output)
+	if errors.Is(err, fs.ErrNotExist) && entry.Variant != "" {
+		return s.restore(fsys, key, entry)
+	}
+	if err != nil || info.Size() != entry.OutputSize || !info.ModTime().Equal(entry.OutputModTime) {
+		return nil, false
+	}
+	return entry, true
+}
+
+// Put records that input produced output on fsys under key and, when
+// variant is not empty and variants are enabled, stores a copy of the
+// output under it
+func (s *Store) Put(fsys fs.FS, key, variant, input, output string) error {
+	if variant != "" && s.MaxSize() > 0 {
+		data, err := readFile(fsys, output)
+		if err != nil {
+			return fmt.Errorf("failed to read output: %w", err)
+		}
+		if err := s.PutVariant(variant, data); err != nil {
+			return err
+		}
+	} else {
+		variant = ""
+	}
+	return s.writeEntry(fsys, key, input, output, variant)
+}
+
+// restore rewrites a missing output on fsys from its stored variant, which
+// requires fsys to be nil or a storage.WriteFS
+func (s *Store) restore(fsys fs.FS, key string, entry *Entry) (*Entry, bool) {
+	data, ok := s.GetVariant(entry.Variant)
+	if !ok {
+		return nil, false
+	}
+	var out storage.WriteFS
+	if fsys == nil {
+		if err := os.MkdirAll(filepath.Dir(entry.Output), 0o755); err != nil {
+			return nil, false
+		}
+	} else if out, ok = fsys.(storage.WriteFS); !ok {
+		return nil, false
+	}
+	w, err := storage.CreateFile(out, entry.Output, 0o644)
+	if err != nil {
+		return nil, false
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Abort()
+		return nil, false
+	}
+	if err := w.Commit(); err != nil {
+		return nil, false
+	}
+	if err := s.writeEntry(fsys, key, entry.Input, entry.Output, entry.Variant); err != nil {
+		return nil, false
+	}
+	return s.readEntryOK(key)
+}
+
+// readEntryOK reads the entry for key, reporting whether it could be read
+func (s *Store) readEntryOK(key string) (*Entry, bool) {
+	entry, err := s.readEntry(key)
+	return entry, err == nil
+}
+
+// readEntry reads and decodes the entry for key
+func (s *Store) readEntry(key string) (*Entry, error) {
+	data, err := os.ReadFile(s.entryPath(key))
+	if err != nil {
+		return nil, err
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// writeEntry records the current state of output on fsys under key
+func (s *Store) writeEntry(fsys fs.FS, key, input, output, variant string) error {
+	info, err := storage.StatFile(fsys, output)
+	if err != nil {
+		return fmt.Errorf("failed to stat output: %w", err)
+	}
+
+	entry := Entry{
+		Input:         input,
+		Output:        output,
+		OutputSize:    info.Size(),
+		OutputModTime: info.ModTime(),
+		Created:       time.Now(),
+		Variant:       variant,
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+
+	path := s.entryPath(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	return nil
+}
+
+// readFile returns the content of name on fsys (nil means the local file
+// system)
+func readFile(fsys fs.FS, name string) ([]byte, error) {
+	file, err := storage.OpenFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it into place, so concurrent readers never see a partial file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".imgai-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// entryPath returns the file path for a key, sharded by its first byte
+func (s *Store) entryPath(key string) string {
+	return filepath.Join(s.dir, key[:2], key+".json")
+}
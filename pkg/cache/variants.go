@@ -0,0 +1,291 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// variantsDir is the subdirectory holding stored encoded outputs
+const variantsDir = "variants"
+
+// lowWaterPercent is the share of the maximum size that eviction on put
+// trims the store down to, leaving room for many puts before the next scan
+const lowWaterPercent = 90
+
+// Stats summarizes the contents of a cache store
+type Stats struct {
+	Entries  int
+	Variants int
+	Bytes    int64
+	MaxSize  int64
+	Oldest   time.Time
+	Newest   time.Time
+}
+
+// variant is a stored encoded output found on disk
+type variant struct {
+	path   string
+	size   int64
+	access time.Time
+}
+
+// MaxSize returns the bound on the total size of stored variants
+func (s *Store) MaxSize() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maxSize
+}
+
+// GetVariant returns the stored encoded output for key and marks it as
+// recently used
+func (s *Store) GetVariant(key string) ([]byte, bool) {
+	path := s.variantPath(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	// The modification time doubles as the last access time for eviction
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return data, true
+}
+
+// PutVariant stores an encoded output under key. When the store grows
+// beyond its maximum size, the least recently used variants are evicted
+// down to lowWaterPercent of it.
+func (s *Store) PutVariant(key string, data []byte) error {
+	maxSize := s.MaxSize()
+	if maxSize <= 0 || int64(len(data)) > maxSize {
+		return nil
+	}
+
+	path := s.variantPath(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	var previous int64
+	if info, err := os.Stat(path); err == nil {
+		previous = info.Size()
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to write cached output: %w", err)
+	}
+
+	if s.addSize(int64(len(data))-previous) <= maxSize {
+		return nil
+	}
+
+	s.pruneMu.Lock()
+	defer s.pruneMu.Unlock()
+	// Another put may have made room while this one waited
+	if s.addSize(0) <= maxSize {
+		return nil
+	}
+	_, err := s.evict(maxSize / 100 * lowWaterPercent)
+	return err
+}
+
+// Prune evicts the least recently used variants until at most maxBytes
+// remain, then drops records whose output is gone and cannot be restored.
+// It returns the number of bytes freed.
+func (s *Store) Prune(maxBytes int64) (int64, error) {
+	s.pruneMu.Lock()
+	defer s.pruneMu.Unlock()
+
+	freed, err := s.evict(maxBytes)
+	if err != nil {
+		return freed, err
+	}
+	return freed, s.dropOrphans()
+}
+
+// addSize adds delta to the tracked size of the variants and returns the
+// new total
+func (s *Store) addSize(delta int64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.size += delta
+	return s.size
+}
+
+// evict removes the least recently used variants until at most maxBytes
+// remain and returns the number of bytes freed. The caller holds pruneMu.
+func (s *Store) evict(maxBytes int64) (int64, error) {
+	variants, err := s.variants()
+	if err != nil {
+		return 0, err
+	}
+	sort.Slice(variants, func(i, j int) bool {
+		return variants[i].access.Before(variants[j].access)
+	})
+
+	var total, freed int64
+	for _, v := range variants {
+		total += v.size
+	}
+	for _, v := range variants {
+		if total <= maxBytes {
+			break
+		}
+		if err := os.Remove(v.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			s.addSize(-freed)
+			return freed, fmt.Errorf("failed to remove cached output: %w", err)
+		}
+		total -= v.size
+		freed += v.size
+	}
+
+	// Puts may have run during the scan, so their sizes are kept
+	s.addSize(-freed)
+	return freed, nil
+}
+
+// Clear removes every record and stored output. Only the variants
+// directory and the record shards are removed; other files are left alone.
+func (s *Store) Clear() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read cache directory: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || (entry.Name() != variantsDir && !isShard(entry.Name())) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(s.dir, entry.Name())); err != nil {
+			return fmt.Errorf("failed to clear cache: %w", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(s.dir, variantsDir), 0o755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	s.mu.Lock()
+	s.size = 0
+	s.mu.Unlock()
+	return nil
+}
+
+// Stats reports the number of records and stored outputs and their size
+func (s *Store) Stats() (Stats, error) {
+	stats := Stats{MaxSize: s.MaxSize()}
+
+	variants, err := s.variants()
+	if err != nil {
+		return stats, err
+	}
+	for _, v := range variants {
+		stats.Variants++
+		stats.Bytes += v.size
+		if stats.Oldest.IsZero() || v.access.Before(stats.Oldest) {
+			stats.Oldest = v.access
+		}
+		if v.access.After(stats.Newest) {
+			stats.Newest = v.access
+		}
+	}
+
+	err = s.walkEntries(func(string) error {
+		stats.Entries++
+		return nil
+	})
+	return stats, err
+}
+
+// dropOrphans removes records whose output is missing and whose stored
+// copy has been evicted
+func (s *Store) dropOrphans() error {
+	return s.walkEntries(func(path string) error {
+		key := strings.TrimSuffix(filepath.Base(path), ".json")
+		entry, err := s.readEntry(key)
+		if err != nil {
+			return os.Remove(path)
+		}
+		if _, err := os.Stat(entry.Output); !errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if entry.Variant != "" {
+			if _, err := os.Stat(s.variantPath(entry.Variant)); err == nil {
+				return nil
+			}
+		}
+		return os.Remove(path)
+	})
+}
+
+// walkEntries calls fn with the path of every record file
+func (s *Store) walkEntries(fn func(path string) error) error {
+	dirs, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read cache directory: %w", err)
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || !isShard(dir.Name()) {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(s.dir, dir.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read cache directory: %w", err)
+		}
+		for _, file := range files {
+			if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+				continue
+			}
+			if err := fn(filepath.Join(s.dir, dir.Name(), file.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isShard returns true if name is a record shard directory: the first two
+// lowercase hex digits of the keys it holds
+func isShard(name string) bool {
+	if len(name) != 2 {
+		return false
+	}
+	for _, c := range name {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// variants lists the stored outputs with their size and last access time
+func (s *Store) variants() ([]variant, error) {
+	var variants []variant
+	root := filepath.Join(s.dir, variantsDir)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(d.Name(), ".tmp") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // removed concurrently
+		}
+		variants = append(variants, variant{path: path, size: info.Size(), access: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+	return variants, nil
+}
+
+// variantPath returns the file path of the stored output for key
+func (s *Store) variantPath(key string) string {
+	return filepath.Join(s.dir, variantsDir, key[:2], key)
+}
@@ -0,0 +1,124 @@
+// Package icons describes the favicon and app icon set written by the icons
+// command and the web manifest and HTML that reference it
+package icons
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// FaviconFile is the multi-resolution ICO file name
+	FaviconFile = "favicon.ico"
+
+	// ManifestFile is the web app manifest file name
+	ManifestFile = "site.webmanifest"
+)
+
+// FaviconSizes are the resolutions stored in FaviconFile
+var FaviconSizes = []int{16, 32, 48}
+
+// Icon is a square PNG icon of the set
+type Icon struct {
+	File string
+	Size int
+
+	// Rel is the <link> relation advertising the icon in HTML, empty when
+	// the icon is only listed in the manifest
+	Rel string
+
+	// Opaque icons are flattened on a solid color because the platform
+	// fills transparent pixels with black
+	Opaque bool
+
+	// Manifest icons are listed in ManifestFile
+	Manifest bool
+}
+
+// Icons is the PNG icon set: browser favicons, Apple touch icons for iPhone
+// and iPad, and the Android and PWA launcher sizes
+var Icons = []Icon{
+	{File: "favicon-16x16.png", Size: 16, Rel: "icon"},
+	{File: "favicon-32x32.png", Size: 32, Rel: "icon"},
+	{File: "apple-touch-icon.png", Size: 180, Rel: "apple-touch-icon", Opaque: true},
+	{File: "apple-touch-icon-152x152.png", Size: 152, Opaque: true},
+	{File: "apple-touch-icon-167x167.png", Size: 167, Opaque: true},
+	{File: "android-chrome-192x192.png", Size: 192, Manifest: true},
+	{File: "android-chrome-512x512.png", Size: 512, Manifest: true},
+}
+
+// ManifestOptions configures the web app manifest
+type ManifestOptions struct {
+	Name            string
+	ShortName       string
+	ThemeColor      string
+	BackgroundColor string
+
+	// Prefix is prepended to icon file names to form their URLs
+	Prefix string
+}
+
+// WriteManifest writes a site.webmanifest listing the manifest icons
+func WriteManifest(w io.Writer, opts ManifestOptions) error {
+	type manifestIcon struct {
+		Src   string `json:"src"`
+		Sizes string `json:"sizes"`
+		Type  string `json:"type"`
+	}
+	manifest := struct {
+		Name            string         `json:"name"`
+		ShortName       string         `json:"short_name"`
+		Icons           []manifestIcon `json:"icons"`
+		ThemeColor      string         `json:"theme_color"`
+		BackgroundColor string         `json:"background_color"`
+		Display         string         `json:"display"`
+	}{
+		Name:            opts.Name,
+		ShortName:       opts.ShortName,
+		ThemeColor:      opts.ThemeColor,
+		BackgroundColor: opts.BackgroundColor,
+		Display:         "standalone",
+	}
+	if manifest.ShortName == "" {
+		manifest.ShortName = opts.Name
+	}
+	for _, icon := range Icons {
+		if icon.Manifest {
+			manifest.Icons = append(manifest.Icons, manifestIcon{
+				Src:   opts.Prefix + icon.File,
+				Sizes: sizes(icon.Size),
+				Type:  "image/png",
+			})
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(manifest)
+}
+
+// WriteHTML writes the <link> tags that reference the icon set, with URLs
+// starting with prefix
+func WriteHTML(w io.Writer, prefix string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<link rel=\"icon\" href=\"%s%s\" sizes=\"any\">\n", prefix, FaviconFile)
+	for _, icon := range Icons {
+		switch icon.Rel {
+		case "":
+		case "icon":
+			fmt.Fprintf(&b, "<link rel=\"icon\" type=\"image/png\" sizes=\"%s\" href=\"%s%s\">\n", sizes(icon.Size), prefix, icon.File)
+		default:
+			fmt.Fprintf(&b, "<link rel=%q sizes=\"%s\" href=\"%s%s\">\n", icon.Rel, sizes(icon.Size), prefix, icon.File)
+		}
+	}
+	fmt.Fprintf(&b, "<link rel=\"manifest\" href=\"%s%s\">\n", prefix, ManifestFile)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// sizes formats a square icon size as used by manifests and <link> tags
+func sizes(size int) string {
+	return fmt.Sprintf("%dx%d", size, size)
+}
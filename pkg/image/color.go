@@ -0,0 +1,42 @@
+package image
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// namedColors are the color names accepted by ParseColor
+var namedColors = map[string]color.NRGBA{
+	"white":       {255, 255, 255, 255},
+	"black":       {0, 0, 0, 255},
+	"gray":        {128, 128, 128, 255},
+	"grey":        {128, 128, 128, 255},
+	"transparent": {0, 0, 0, 0},
+}
+
+// ParseColor parses a color given as a name (white, black, gray,
+// transparent) or as hex in the form #rgb, #rrggbb or #rrggbbaa
+func ParseColor(s string) (color.NRGBA, error) {
+	text := strings.ToLower(strings.TrimSpace(s))
+	if c, ok := namedColors[text]; ok {
+		return c, nil
+	}
+
+	hex := strings.TrimPrefix(text, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	if len(hex) != 8 {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q (use a name or #rrggbb)", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q (use a name or #rrggbb)", s)
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
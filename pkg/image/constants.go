@@ -16,4 +16,4 @@ const (
 )
 
 // Supported image formats
-var SupportedFormats = []string{"jpg", "jpeg", "png", "webp"}
+var SupportedFormats = []string{"jpg", "jpeg", "png", "webp", "gif", "bmp", "tif", "tiff"}
@@ -1,12 +1,12 @@
 package image
 
 import (
+	"context"
 	"fmt"
-	"image"
-	"image/jpeg"
-	"os"
+	"io"
+	"io/fs"
 
-	"github.com/disintegration/imaging"
+	"github.com/hiroki-abe-58/imgai/pkg/storage"
 )
 
 // ConvertOptions holds options for converting an image
@@ -14,32 +14,42 @@ type ConvertOptions struct {
 	Format  string
 	Quality int
 	Output  string
+	Limits  Limits `json:"-"`
+
+	// TIFFCompression, GIFColors, GIFPalette and GIFDither tune TIFF and
+	// GIF output as described in EncodeOptions
+	TIFFCompression string `json:",omitempty"`
+	GIFColors       int    `json:",omitempty"`
+	GIFPalette      string `json:",omitempty"`
+	GIFDither       string `json:",omitempty"`
+
+	// FS holds the input file and Out receives the output file (nil means
+	// the local file system, addressed with native paths)
+	FS  fs.FS           `json:"-"`
+	Out storage.WriteFS `json:"-"`
 }
 
-// ConvertImage converts an image to a different format
-func ConvertImage(inputPath string, opts ConvertOptions) error {
+// ConvertImage converts an image file to a different format and returns
+// a Result describing the written file
+func ConvertImage(ctx context.Context, inputPath string, opts ConvertOptions) (Result, error) {
 	// Validate input file
-	if err := ValidateInputFile(inputPath); err != nil {
-		return err
+	if err := ValidateInputFile(opts.FS, inputPath); err != nil {
+		return Result{}, err
 	}
 
-	// Normalize and validate format
+	// Normalize and validate format and quality
 	opts.Format = NormalizeFormat(opts.Format)
-	if err := ValidateFormat(opts.Format); err != nil {
-		return err
-	}
-
-	// Validate quality for JPEG
-	if opts.Format == "jpg" {
-		if err := ValidateQuality(opts.Quality); err != nil {
-			return err
-		}
+	if err := validateConvertOptions(opts); err != nil {
+		return Result{}, err
 	}
 
 	// Open the image
-	img, err := imaging.Open(inputPath)
+	img, inputFormat, err := OpenImage(opts.FS, inputPath, opts.Limits)
 	if err != nil {
-		return fmt.Errorf("%w: %v", ErrOpenFile, err)
+		return Result{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
 	}
 
 	// Determine output path
@@ -50,40 +60,62 @@ func ConvertImage(inputPath string, opts ConvertOptions) error {
 	}
 
 	// Save with format-specific encoding
-	if err := saveWithFormat(img, outputPath, opts.Format, opts.Quality); err != nil {
-		return err
+	result := NewResult(img, inputFormat)
+	result.Path = outputPath
+	encode := func(w io.Writer) error {
+		return result.EncodeWith(w, img, opts.Format, opts.encodeOptions())
+	}
+	if err := WriteFileAtomic(ctx, opts.Out, outputPath, encode); err != nil {
+		return Result{}, err
 	}
 
-	fmt.Printf("✓ Converted: %s → %s (%s)\n", inputPath, outputPath, opts.Format)
-	return nil
+	return result, nil
 }
 
-// saveWithFormat saves image with specific format encoding
-func saveWithFormat(img image.Image, outputPath, format string, quality int) error {
-	switch format {
-	case "jpg":
-		return saveAsJPEG(img, outputPath, quality)
-	case "png":
-		return imaging.Save(img, outputPath)
-	case "webp":
-		return imaging.Save(img, outputPath)
-	default:
-		return fmt.Errorf("%w: %s", ErrInvalidFormat, format)
+// ConvertStream decodes an image from r and encodes it to w in opts.Format
+func ConvertStream(ctx context.Context, r io.Reader, w io.Writer, opts ConvertOptions) (Result, error) {
+	opts.Format = NormalizeFormat(opts.Format)
+	if err := validateConvertOptions(opts); err != nil {
+		return Result{}, err
 	}
-}
 
-// saveAsJPEG saves image as JPEG with specified quality
-func saveAsJPEG(img image.Image, outputPath string, quality int) error {
-	file, err := os.Create(outputPath)
+	img, inputFormat, err := Decode(r, opts.Limits)
 	if err != nil {
-		return fmt.Errorf("%w: %v", ErrSaveImage, err)
+		return Result{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
 	}
-	defer file.Close()
 
-	opts := &jpeg.Options{Quality: quality}
-	if err := jpeg.Encode(file, img, opts); err != nil {
-		return fmt.Errorf("%w: %v", ErrEncodeImage, err)
+	result := NewResult(img, inputFormat)
+	if err := result.EncodeWith(w, img, opts.Format, opts.encodeOptions()); err != nil {
+		return Result{}, fmt.Errorf("%w: %w", ErrEncodeImage, err)
 	}
+	return result, nil
+}
 
+// validateConvertOptions checks the target format, the encoder settings
+// and, for JPEG, the quality
+func validateConvertOptions(opts ConvertOptions) error {
+	if err := ValidateFormat(opts.Format); err != nil {
+		return err
+	}
+	if err := ValidateEncodeOptions(opts.encodeOptions()); err != nil {
+		return err
+	}
+	if opts.Format == "jpg" {
+		return ValidateQuality(opts.Quality)
+	}
 	return nil
 }
+
+// encodeOptions returns the encoder settings in opts
+func (opts ConvertOptions) encodeOptions() EncodeOptions {
+	return EncodeOptions{
+		Quality:         opts.Quality,
+		TIFFCompression: opts.TIFFCompression,
+		GIFColors:       opts.GIFColors,
+		GIFPalette:      opts.GIFPalette,
+		GIFDither:       opts.GIFDither,
+	}
+}
@@ -0,0 +1,107 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/fs"
+
+	"github.com/hiroki-abe-58/imgai/pkg/storage"
+
+	// Register the WebP decoder alongside those registered by imaging
+	_ "golang.org/x/image/webp"
+)
+
+// OpenImage opens and decodes an image file on fsys (nil means the local
+// file system) and returns it with its normalized format name. Limits are
+// enforced from the file size and image header before any pixel data is
+// decoded.
+func OpenImage(fsys fs.FS, path string, limits Limits) (image.Image, string, error) {
+	file, err := storage.OpenFile(fsys, path)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %w", ErrOpenFile, err)
+	}
+	defer file.Close()
+
+	if limits.MaxFileSize > 0 {
+		info, err := file.Stat()
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: %w", ErrOpenFile, err)
+		}
+		if err := limits.CheckFileSize(path, info.Size()); err != nil {
+			return nil, "", err
+		}
+	}
+
+	img, format, err := Decode(file, limits)
+	if err != nil {
+		var limitErr *LimitError
+		if errors.As(err, &limitErr) {
+			limitErr.Path = path
+		}
+		return nil, "", err
+	}
+	return img, format, nil
+}
+
+// Decode decodes an image from r and returns it with its normalized format
+// name, sniffed from the data. Limits are enforced from the bytes read and
+// the image header before any pixel data is decoded, so r may be a pipe.
+func Decode(r io.Reader, limits Limits) (image.Image, string, error) {
+	if limits.MaxFileSize > 0 {
+		r = &limitedReader{r: r, max: limits.MaxFileSize}
+	}
+
+	if limits.MaxPixels > 0 || limits.MaxWidth > 0 || limits.MaxHeight > 0 {
+		// Keep the header bytes so the full decode can replay them
+		var header bytes.Buffer
+		cfg, _, err := image.DecodeConfig(io.TeeReader(r, &header))
+		if err != nil {
+			return nil, "", decodeError(err)
+		}
+		if err := limits.CheckConfig("", cfg); err != nil {
+			return nil, "", err
+		}
+		r = io.MultiReader(&header, r)
+	}
+
+	img, format, err := image.Decode(r)
+	if err != nil {
+		return nil, "", decodeError(err)
+	}
+	return img, NormalizeFormat(format), nil
+}
+
+// decodeError wraps a decoder error, passing limit errors through unchanged
+func decodeError(err error) error {
+	var limitErr *LimitError
+	if errors.As(err, &limitErr) {
+		return limitErr
+	}
+	return fmt.Errorf("%w: %w", ErrDecodeImage, err)
+}
+
+// limitedReader fails with a LimitError once more than max bytes are read
+type limitedReader struct {
+	r    io.Reader
+	max  int64
+	read int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.read > l.max {
+		return 0, &LimitError{Limit: "file size", Value: l.read, Max: l.max}
+	}
+	// Read at most one byte past the limit to detect oversized input
+	if remaining := l.max + 1 - l.read; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.max {
+		return n, &LimitError{Limit: "file size", Value: l.read, Max: l.max}
+	}
+	return n, err
+}
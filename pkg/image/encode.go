@@ -0,0 +1,163 @@
+package image
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/tiff"
+)
+
+// TIFF compressions and GIF palettes and dithering accepted by EncodeOptions
+var (
+	TIFFCompressions = []string{"deflate", "none"}
+	GIFPalettes      = []string{"adaptive", "plan9", "websafe"}
+	GIFDithers       = []string{"floyd-steinberg", "none"}
+)
+
+// EncodeOptions holds format-specific encoder settings. Zero values select
+// the defaults.
+type EncodeOptions struct {
+	// Quality is the JPEG quality (1-100)
+	Quality int
+
+	// TIFFCompression is deflate (default) or none
+	TIFFCompression string
+
+	// GIFColors is the size of the adaptive GIF palette (2-256, default 256)
+	GIFColors int
+
+	// GIFPalette chooses the GIF colors: adaptive (default) picks them from
+	// the image, plan9 and websafe use those fixed palettes
+	GIFPalette string
+
+	// GIFDither is floyd-steinberg (default) or none
+	GIFDither string
+}
+
+// ValidateEncodeOptions checks the format-specific settings in opts
+func ValidateEncodeOptions(opts EncodeOptions) error {
+	if opts.Quality != 0 {
+		if err := ValidateQuality(opts.Quality); err != nil {
+			return err
+		}
+	}
+	if opts.GIFColors != 0 && (opts.GIFColors < 2 || opts.GIFColors > 256) {
+		return fmt.Errorf("%w: GIF colors must be between 2 and 256, got %d", ErrInvalidFormat, opts.GIFColors)
+	}
+	checks := []struct {
+		name, value string
+		allowed     []string
+	}{
+		{"TIFF compression", opts.TIFFCompression, TIFFCompressions},
+		{"GIF palette", opts.GIFPalette, GIFPalettes},
+		{"GIF dither", opts.GIFDither, GIFDithers},
+	}
+	for _, check := range checks {
+		if check.value != "" && !contains(check.allowed, check.value) {
+			return fmt.Errorf("%w: unsupported %s %q (supported: %s)",
+				ErrInvalidFormat, check.name, check.value, strings.Join(check.allowed, ", "))
+		}
+	}
+	return nil
+}
+
+// Encode encodes img to w in the given format. quality applies to JPEG
+// output only; zero selects the encoder default.
+func Encode(w io.Writer, img image.Image, format string, quality int) error {
+	return EncodeWith(w, img, format, EncodeOptions{Quality: quality})
+}
+
+// EncodeWith encodes img to w in the given format with the settings in
+// opts that apply to it
+func EncodeWith(w io.Writer, img image.Image, format string, opts EncodeOptions) error {
+	format = NormalizeFormat(format)
+	switch format {
+	case "jpg":
+		if opts.Quality > 0 {
+			return jpeg.Encode(w, img, &jpeg.Options{Quality: opts.Quality})
+		}
+		return imaging.Encode(w, img, imaging.JPEG)
+	case "gif":
+		return gif.Encode(w, img, gifOptions(opts))
+	case "tiff":
+		compression := tiff.Deflate
+		if opts.TIFFCompression == "none" {
+			compression = tiff.Uncompressed
+		}
+		return tiff.Encode(w, img, &tiff.Options{Compression: compression})
+	case "webp":
+		// WebP output is always lossless, so quality does not apply
+		return encodeWebP(w, img)
+	}
+
+	f, err := imaging.FormatFromExtension(format)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidFormat, format)
+	}
+	return imaging.Encode(w, img, f)
+}
+
+// FormatFromPath returns the normalized format implied by the extension of path
+func FormatFromPath(path string) (string, error) {
+	format := NormalizeFormat(strings.TrimPrefix(filepath.Ext(path), "."))
+	if format == "" {
+		return "", fmt.Errorf("%w: cannot determine format of %s", ErrInvalidFormat, path)
+	}
+	return format, nil
+}
+
+// CanEncode returns true if Encode can write format
+func CanEncode(format string) bool {
+	switch format = NormalizeFormat(format); format {
+	case "jpg", "webp":
+		return true
+	}
+	_, err := imaging.FormatFromExtension(format)
+	return err == nil
+}
+
+// gifOptions returns the GIF encoder settings for opts
+func gifOptions(opts EncodeOptions) *gif.Options {
+	options := &gif.Options{NumColors: 256, Quantizer: medianCut{}, Drawer: draw.FloydSteinberg}
+	switch opts.GIFPalette {
+	case "plan9":
+		options.Quantizer = fixedPalette(palette.Plan9)
+	case "websafe":
+		options.Quantizer = fixedPalette(palette.WebSafe)
+	default:
+		if opts.GIFColors > 0 {
+			options.NumColors = opts.GIFColors
+		}
+	}
+	if opts.GIFDither == "none" {
+		options.Drawer = draw.Src
+	}
+	return options
+}
+
+// fixedPalette is a draw.Quantizer that always returns the same colors
+type fixedPalette color.Palette
+
+// Quantize implements draw.Quantizer
+func (f fixedPalette) Quantize(p color.Palette, _ image.Image) color.Palette {
+	return append(p, f...)
+}
+
+// contains returns true if values holds value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
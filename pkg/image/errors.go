@@ -1,6 +1,9 @@
 package image
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // Error definitions for image processing
 var (
@@ -28,3 +31,27 @@ var (
 	// ErrSaveImage is returned when image cannot be saved
 	ErrSaveImage = errors.New("failed to save image")
 )
+
+// ErrLimitExceeded is returned when an input exceeds a configured resource limit
+var ErrLimitExceeded = errors.New("image exceeds resource limit")
+
+// LimitError describes which resource limit an input exceeded
+type LimitError struct {
+	Path  string
+	Limit string
+	Value int64
+	Max   int64
+}
+
+// Error implements the error interface
+func (e *LimitError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("%v: %s is %d (max %d)", ErrLimitExceeded, e.Limit, e.Value, e.Max)
+	}
+	return fmt.Sprintf("%v: %s %s is %d (max %d)", ErrLimitExceeded, e.Path, e.Limit, e.Value, e.Max)
+}
+
+// Unwrap allows errors.Is(err, ErrLimitExceeded)
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
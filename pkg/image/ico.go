@@ -0,0 +1,79 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+)
+
+// maxICOSize is the largest width or height an ICO entry can describe
+const maxICOSize = 256
+
+// EncodeICO writes images as a multi-resolution ICO file. Entries are stored
+// as PNG, which every current browser and Windows since Vista accept.
+func EncodeICO(w io.Writer, images []image.Image) error {
+	if len(images) == 0 {
+		return fmt.Errorf("%w: an icon needs at least one image", ErrEncodeImage)
+	}
+
+	entries := make([][]byte, len(images))
+	for i, img := range images {
+		bounds := img.Bounds()
+		if bounds.Dx() > maxICOSize || bounds.Dy() > maxICOSize {
+			return fmt.Errorf("%w: icon entries must be at most %dx%d, got %dx%d",
+				ErrEncodeImage, maxICOSize, maxICOSize, bounds.Dx(), bounds.Dy())
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return err
+		}
+		entries[i] = buf.Bytes()
+	}
+
+	// ICONDIR header: reserved, type (1 = icon), image count
+	header := []uint16{0, 1, uint16(len(images))}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+
+	// One 16 byte ICONDIRENTRY per image, followed by the image data
+	offset := 6 + 16*len(images)
+	for i, img := range images {
+		bounds := img.Bounds()
+		entry := struct {
+			Width, Height     uint8
+			Colors, Reserved  uint8
+			Planes, BitCount  uint16
+			Size, ImageOffset uint32
+		}{
+			Width:       icoDimension(bounds.Dx()),
+			Height:      icoDimension(bounds.Dy()),
+			Planes:      1,
+			BitCount:    32,
+			Size:        uint32(len(entries[i])),
+			ImageOffset: uint32(offset),
+		}
+		if err := binary.Write(w, binary.LittleEndian, entry); err != nil {
+			return err
+		}
+		offset += len(entries[i])
+	}
+	for _, data := range entries {
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// icoDimension encodes a width or height for an ICONDIRENTRY, where 0
+// stands for 256
+func icoDimension(v int) uint8 {
+	if v >= maxICOSize {
+		return 0
+	}
+	return uint8(v)
+}
@@ -0,0 +1,40 @@
+package image
+
+import "image"
+
+// Limits bounds the resources an input image may consume before it is
+// fully decoded. Zero values mean no limit.
+type Limits struct {
+	MaxPixels   int64
+	MaxFileSize int64
+	MaxWidth    int
+	MaxHeight   int
+}
+
+// IsZero returns true if no limit is set
+func (l Limits) IsZero() bool {
+	return l == Limits{}
+}
+
+// CheckFileSize checks the encoded file size against MaxFileSize
+func (l Limits) CheckFileSize(path string, size int64) error {
+	if l.MaxFileSize > 0 && size > l.MaxFileSize {
+		return &LimitError{Path: path, Limit: "file size", Value: size, Max: l.MaxFileSize}
+	}
+	return nil
+}
+
+// CheckConfig checks decoded dimensions from an image header against the limits
+func (l Limits) CheckConfig(path string, cfg image.Config) error {
+	if l.MaxWidth > 0 && cfg.Width > l.MaxWidth {
+		return &LimitError{Path: path, Limit: "width", Value: int64(cfg.Width), Max: int64(l.MaxWidth)}
+	}
+	if l.MaxHeight > 0 && cfg.Height > l.MaxHeight {
+		return &LimitError{Path: path, Limit: "height", Value: int64(cfg.Height), Max: int64(l.MaxHeight)}
+	}
+	pixels := int64(cfg.Width) * int64(cfg.Height)
+	if l.MaxPixels > 0 && pixels > l.MaxPixels {
+		return &LimitError{Path: path, Limit: "pixel count", Value: pixels, Max: l.MaxPixels}
+	}
+	return nil
+}
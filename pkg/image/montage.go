@@ -0,0 +1,177 @@
+package image
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// labelHeight is the height of the caption line below a montage tile
+const labelHeight = 17
+
+// MaxSheetSize is the largest width or height of a contact sheet, the
+// largest image JPEG and GIF can encode
+const MaxSheetSize = 65535
+
+// DefaultSheetPixels bounds the sheets of a montage when no row count is
+// given, keeping a sheet at about 160 MB while it is drawn
+const DefaultSheetPixels = 40_000_000
+
+// MontageOptions configures a contact sheet made by Montage
+type MontageOptions struct {
+	// Columns is the number of tiles per row
+	Columns int
+
+	// TileWidth and TileHeight bound each thumbnail, which keeps its
+	// aspect ratio and is centered in its tile
+	TileWidth  int
+	TileHeight int
+
+	// Gap is the space around and between tiles in pixels
+	Gap int
+
+	// Background fills the sheet (nil means white)
+	Background color.Color
+
+	// Labels adds a caption line below each tile
+	Labels bool
+}
+
+// Tile is an image placed on a contact sheet with its caption
+type Tile struct {
+	Image image.Image
+	Label string
+}
+
+// Thumbnail scales img down to fit within width x height, keeping its
+// aspect ratio. Smaller images are returned unchanged.
+func Thumbnail(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() <= width && bounds.Dy() <= height {
+		return img
+	}
+	return imaging.Fit(img, width, height, imaging.Lanczos)
+}
+
+// Montage lays out tiles in order in a grid of opts.Columns columns and
+// returns the sheet. The last row may be incomplete.
+func Montage(tiles []Tile, opts MontageOptions) *image.NRGBA {
+	opts.Columns = max(opts.Columns, 1)
+	sheet := NewSheet(opts, (len(tiles)+opts.Columns-1)/opts.Columns)
+	for i, tile := range tiles {
+		DrawTile(sheet, opts, i, tile)
+	}
+	return sheet
+}
+
+// NewSheet returns an empty contact sheet with room for rows rows of tiles,
+// to be drawn on with DrawTile
+func NewSheet(opts MontageOptions, rows int) *image.NRGBA {
+	opts.Columns = max(opts.Columns, 1)
+	width, height := MontageSize(opts, rows)
+	return imaging.New(width, height, opts.background())
+}
+
+// DrawTile draws tile as the i-th tile of a sheet made by NewSheet with the
+// same options, counting row by row from the top left. Tiles outside the
+// sheet are clipped.
+func DrawTile(sheet draw.Image, opts MontageOptions, i int, tile Tile) {
+	columns := max(opts.Columns, 1)
+	x := opts.Gap + (i%columns)*(opts.TileWidth+opts.Gap)
+	y := opts.Gap + (i/columns)*(opts.cellHeight()+opts.Gap)
+
+	thumb := Thumbnail(tile.Image, opts.TileWidth, opts.TileHeight)
+	bounds := thumb.Bounds()
+	at := image.Pt(x+(opts.TileWidth-bounds.Dx())/2, y+(opts.TileHeight-bounds.Dy())/2)
+	draw.Draw(sheet, image.Rectangle{Min: at, Max: at.Add(bounds.Size())}, thumb, bounds.Min, draw.Over)
+
+	if opts.Labels {
+		drawLabel(sheet, tile.Label, x, y+opts.TileHeight, opts.TileWidth, contrastColor(opts.background()))
+	}
+}
+
+// MontageSize returns the size of a sheet with the given number of rows
+func MontageSize(opts MontageOptions, rows int) (int, int) {
+	width := opts.Columns*opts.TileWidth + (opts.Columns+1)*opts.Gap
+	height := rows*opts.cellHeight() + (rows+1)*opts.Gap
+	return width, height
+}
+
+// SheetLimit returns the largest width or height of a sheet in format:
+// MaxSheetSize, or less for formats that cannot encode such large images
+func SheetLimit(format string) int {
+	if NormalizeFormat(format) == "webp" {
+		return MaxWebPSize
+	}
+	return MaxSheetSize
+}
+
+// MaxMontageRows returns the most rows a sheet can have without exceeding
+// limit pixels, or 0 if even a single row does not fit
+func MaxMontageRows(opts MontageOptions, limit int) int {
+	width, _ := MontageSize(opts, 1)
+	if width > limit {
+		return 0
+	}
+	return (limit - opts.Gap) / (opts.cellHeight() + opts.Gap)
+}
+
+// MontageRowsWithin returns the most rows a sheet can have with at most
+// pixels pixels in total, and at least one
+func MontageRowsWithin(opts MontageOptions, pixels int64) int {
+	width, _ := MontageSize(opts, 1)
+	rowHeight := int64(opts.cellHeight() + opts.Gap)
+	rows := (pixels/int64(width) - int64(opts.Gap)) / rowHeight
+	return int(max(rows, 1))
+}
+
+// cellHeight returns the height of a tile including its caption
+func (o MontageOptions) cellHeight() int {
+	if o.Labels {
+		return o.TileHeight + labelHeight
+	}
+	return o.TileHeight
+}
+
+// background returns the sheet background, white by default
+func (o MontageOptions) background() color.Color {
+	if o.Background == nil {
+		return color.White
+	}
+	return o.Background
+}
+
+// drawLabel draws text centered in a caption line of the given width at
+// (x, y), shortened with "..." when it does not fit
+func drawLabel(dst draw.Image, text string, x, y, width int, c color.Color) {
+	face := basicfont.Face7x13
+	runes := []rune(text)
+	for len(runes) > 0 && font.MeasureString(face, text).Ceil() > width {
+		runes = runes[:len(runes)-1]
+		text = string(runes) + "..."
+	}
+
+	drawer := &font.Drawer{Dst: dst, Src: image.NewUniform(c), Face: face}
+	textWidth := drawer.MeasureString(text).Ceil()
+	drawer.Dot = fixed.P(x+(width-textWidth)/2, y+(labelHeight+face.Ascent-face.Descent)/2)
+	drawer.DrawString(text)
+}
+
+// contrastColor returns black or white, whichever is easier to read on
+// background
+func contrastColor(background color.Color) color.Color {
+	r, g, b, a := background.RGBA()
+	if a < 0x8000 {
+		return color.Black
+	}
+	luma := (299*r + 587*g + 114*b) / 1000
+	if luma < 0x8000 {
+		return color.White
+	}
+	return color.Black
+}
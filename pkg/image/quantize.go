@@ -0,0 +1,165 @@
+package image
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// maxQuantizeSamples bounds the number of pixels sampled to build a palette
+const maxQuantizeSamples = 1 << 18
+
+// medianCut is a draw.Quantizer that builds an adaptive palette by
+// repeatedly splitting the most populous box of colors at its median along
+// its widest channel. Mostly transparent pixels get one transparent entry.
+type medianCut struct{}
+
+// bucket is a color of the histogram, reduced to 5 bits per channel, with
+// the number of sampled pixels having it
+type bucket struct {
+	rgb   [3]uint8
+	count int
+}
+
+// colorBox is a set of histogram buckets that becomes one palette entry
+type colorBox []bucket
+
+// Quantize implements draw.Quantizer, appending up to cap(p)-len(p) colors
+func (medianCut) Quantize(p color.Palette, m image.Image) color.Palette {
+	histogram, transparent := sampleColors(m)
+	n := cap(p) - len(p)
+	if transparent {
+		p = append(p, color.NRGBA{})
+		n--
+	}
+	if n <= 0 || len(histogram) == 0 {
+		return p
+	}
+
+	boxes := []colorBox{histogram}
+	for len(boxes) < n {
+		i := splittable(boxes)
+		if i < 0 {
+			break
+		}
+		low, high := boxes[i].split()
+		boxes[i] = low
+		boxes = append(boxes, high)
+	}
+	for _, box := range boxes {
+		p = append(p, box.average())
+	}
+	return p
+}
+
+// sampleColors returns the histogram of the opaque colors of m, sampling
+// at most maxQuantizeSamples pixels, and whether m has transparent pixels
+func sampleColors(m image.Image) (colorBox, bool) {
+	bounds := m.Bounds()
+	step := 1
+	for (bounds.Dx()/step)*(bounds.Dy()/step) > maxQuantizeSamples {
+		step++
+	}
+
+	counts := make(map[[3]uint8]int)
+	transparent := false
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			c := color.NRGBAModel.Convert(m.At(x, y)).(color.NRGBA)
+			if c.A < 0x80 {
+				transparent = true
+				continue
+			}
+			counts[[3]uint8{c.R >> 3, c.G >> 3, c.B >> 3}]++
+		}
+	}
+
+	histogram := make(colorBox, 0, len(counts))
+	for rgb, count := range counts {
+		histogram = append(histogram, bucket{rgb: rgb, count: count})
+	}
+	// Map iteration is random; sort so that palettes are reproducible
+	sort.Slice(histogram, func(i, j int) bool {
+		a, b := histogram[i].rgb, histogram[j].rgb
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		if a[1] != b[1] {
+			return a[1] < b[1]
+		}
+		return a[2] < b[2]
+	})
+	return histogram, transparent
+}
+
+// splittable returns the index of the box to split next, the most populous
+// one holding more than one color, or -1 when none is left
+func splittable(boxes []colorBox) int {
+	best, bestCount := -1, 0
+	for i, box := range boxes {
+		if len(box) < 2 {
+			continue
+		}
+		if count := box.count(); count > bestCount {
+			best, bestCount = i, count
+		}
+	}
+	return best
+}
+
+// count returns the number of pixels in b
+func (b colorBox) count() int {
+	total := 0
+	for _, bucket := range b {
+		total += bucket.count
+	}
+	return total
+}
+
+// split divides b in two halves of about equal population along its
+// widest channel
+func (b colorBox) split() (colorBox, colorBox) {
+	channel, widest := 0, -1
+	for c := 0; c < 3; c++ {
+		low, high := uint8(255), uint8(0)
+		for _, bucket := range b {
+			low = min(low, bucket.rgb[c])
+			high = max(high, bucket.rgb[c])
+		}
+		if int(high-low) > widest {
+			channel, widest = c, int(high-low)
+		}
+	}
+	sort.SliceStable(b, func(i, j int) bool {
+		return b[i].rgb[channel] < b[j].rgb[channel]
+	})
+
+	half := b.count() / 2
+	seen := 0
+	for i, bucket := range b[:len(b)-1] {
+		seen += bucket.count
+		if seen >= half {
+			return b[:i+1], b[i+1:]
+		}
+	}
+	return b[:len(b)-1], b[len(b)-1:]
+}
+
+// average returns the population-weighted mean color of b
+func (b colorBox) average() color.Color {
+	var sum [3]int
+	total := 0
+	for _, bucket := range b {
+		for c := range sum {
+			// Expand the 5 bit value to the middle of its 8 bit range
+			sum[c] += (int(bucket.rgb[c])<<3 | 4) * bucket.count
+		}
+		total += bucket.count
+	}
+	return color.NRGBA{
+		R: uint8(sum[0] / total),
+		G: uint8(sum[1] / total),
+		B: uint8(sum[2] / total),
+		A: 0xff,
+	}
+}
@@ -1,9 +1,15 @@
 package image
 
 import (
+	"context"
 	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/fs"
 
 	"github.com/disintegration/imaging"
+	"github.com/hiroki-abe-58/imgai/pkg/storage"
 )
 
 // ResizeOptions holds options for resizing an image
@@ -11,51 +17,129 @@ type ResizeOptions struct {
 	Width  int
 	Height int
 	Output string
+	Limits Limits `json:"-"`
+
+	// Pad fits the image within Width x Height, keeping its aspect ratio,
+	// and centers it on a Background canvas (nil means transparent)
+	// instead of stretching it. It requires both dimensions.
+	Pad        bool        `json:",omitempty"`
+	Background color.Color `json:",omitempty"`
+
+	// FS holds the input file and Out receives the output file (nil means
+	// the local file system, addressed with native paths)
+	FS  fs.FS           `json:"-"`
+	Out storage.WriteFS `json:"-"`
 }
 
-// ResizeImage resizes an image based on the provided options
-func ResizeImage(inputPath string, opts ResizeOptions) error {
+// ResizeImage resizes an image file based on the provided options and
+// returns a Result describing the written file
+func ResizeImage(ctx context.Context, inputPath string, opts ResizeOptions) (Result, error) {
 	// Validate input file
-	if err := ValidateInputFile(inputPath); err != nil {
-		return err
+	if err := ValidateInputFile(opts.FS, inputPath); err != nil {
+		return Result{}, err
 	}
 
 	// Validate dimensions
 	if err := ValidateDimensions(opts.Width, opts.Height); err != nil {
-		return err
+		return Result{}, err
 	}
 
 	// Open the image
-	img, err := imaging.Open(inputPath)
+	img, inputFormat, err := OpenImage(opts.FS, inputPath, opts.Limits)
 	if err != nil {
-		return fmt.Errorf("%w: %v", ErrOpenFile, err)
+		return Result{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
 	}
-
-	// Get original dimensions
-	bounds := img.Bounds()
-	origWidth := bounds.Dx()
-	origHeight := bounds.Dy()
-
-	// Calculate target dimensions
-	targetWidth, targetHeight := calculateDimensions(origWidth, origHeight, opts.Width, opts.Height)
 
 	// Resize the image
-	resized := imaging.Resize(img, targetWidth, targetHeight, imaging.Lanczos)
+	resized := Resize(img, opts)
 
 	// Determine output path
 	outputPath := opts.Output
 	if outputPath == "" {
-		suffix := fmt.Sprintf("_resized_%dx%d", targetWidth, targetHeight)
+		bounds := resized.Bounds()
+		suffix := fmt.Sprintf("_resized_%dx%d", bounds.Dx(), bounds.Dy())
 		outputPath = GenerateOutputPath(inputPath, suffix, ".jpg")
 	}
 
 	// Save the resized image
-	if err := imaging.Save(resized, outputPath); err != nil {
-		return fmt.Errorf("%w: %v", ErrSaveImage, err)
+	format, err := FormatFromPath(outputPath)
+	if err != nil {
+		return Result{}, fmt.Errorf("%w: %w", ErrSaveImage, err)
+	}
+	result := NewResult(img, inputFormat)
+	result.Path = outputPath
+	encode := func(w io.Writer) error {
+		return result.EncodeTo(w, resized, format, 0)
+	}
+	if err := WriteFileAtomic(ctx, opts.Out, outputPath, encode); err != nil {
+		return Result{}, err
+	}
+
+	return result, nil
+}
+
+// ResizeStream decodes an image from r, resizes it and encodes the result
+// to w in format, or in the input format when format is empty
+func ResizeStream(ctx context.Context, r io.Reader, w io.Writer, format string, opts ResizeOptions) (Result, error) {
+	if err := ValidateDimensions(opts.Width, opts.Height); err != nil {
+		return Result{}, err
+	}
+
+	img, inputFormat, err := Decode(r, opts.Limits)
+	if err != nil {
+		return Result{}, err
 	}
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	if format == "" {
+		format = inputFormat
+	}
+	result := NewResult(img, inputFormat)
+	if err := result.EncodeTo(w, Resize(img, opts), format, 0); err != nil {
+		return Result{}, fmt.Errorf("%w: %w", ErrEncodeImage, err)
+	}
+	return result, nil
+}
+
+// ResizedSize returns the dimensions Resize produces from a source of
+// width x height pixels, so callers can bound them before resizing
+func ResizedSize(width, height int, opts ResizeOptions) (int, int) {
+	if opts.Pad && opts.Width > 0 && opts.Height > 0 {
+		return opts.Width, opts.Height
+	}
+	return calculateDimensions(width, height, opts.Width, opts.Height)
+}
+
+// Resize returns img scaled to the dimensions in opts, keeping the aspect
+// ratio when only one dimension is set or when padding
+func Resize(img image.Image, opts ResizeOptions) image.Image {
+	bounds := img.Bounds()
+	if opts.Pad && opts.Width > 0 && opts.Height > 0 {
+		return pad(img, opts.Width, opts.Height, opts.Background)
+	}
+	width, height := calculateDimensions(bounds.Dx(), bounds.Dy(), opts.Width, opts.Height)
+	return imaging.Resize(img, width, height, imaging.Lanczos)
+}
+
+// pad scales img up or down to fit within width x height and centers it on
+// a canvas of that size filled with background
+func pad(img image.Image, width, height int, background color.Color) image.Image {
+	if background == nil {
+		background = color.Transparent
+	}
+	bounds := img.Bounds()
+	scale := min(float64(width)/float64(bounds.Dx()), float64(height)/float64(bounds.Dy()))
+	fitWidth := max(int(float64(bounds.Dx())*scale+0.5), 1)
+	fitHeight := max(int(float64(bounds.Dy())*scale+0.5), 1)
 
-	fmt.Printf("✓ Resized: %s → %s (%dx%d)\n", inputPath, outputPath, targetWidth, targetHeight)
-	return nil
+	canvas := imaging.New(width, height, background)
+	fitted := imaging.Resize(img, min(fitWidth, width), min(fitHeight, height), imaging.Lanczos)
+	return imaging.OverlayCenter(canvas, fitted, 1)
 }
 
 // calculateDimensions calculates target dimensions while maintaining aspect ratio
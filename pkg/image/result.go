@@ -0,0 +1,68 @@
+package image
+
+import (
+	"image"
+	"io"
+)
+
+// Result describes an image produced by the processing functions. They
+// print nothing, so callers decide what to report.
+type Result struct {
+	// Path is the written file, empty when the output was an io.Writer
+	Path string
+
+	// Format, Width, Height and Bytes describe the encoded output
+	Format string
+	Width  int
+	Height int
+	Bytes  int64
+
+	// SourceFormat, SourceWidth and SourceHeight describe the decoded input
+	SourceFormat string
+	SourceWidth  int
+	SourceHeight int
+}
+
+// NewResult returns a Result describing src, decoded from format, as the
+// input of an operation
+func NewResult(src image.Image, format string) Result {
+	bounds := src.Bounds()
+	return Result{
+		SourceFormat: NormalizeFormat(format),
+		SourceWidth:  bounds.Dx(),
+		SourceHeight: bounds.Dy(),
+	}
+}
+
+// EncodeTo encodes img to w like Encode and records the output format,
+// dimensions and encoded size in r
+func (r *Result) EncodeTo(w io.Writer, img image.Image, format string, quality int) error {
+	return r.EncodeWith(w, img, format, EncodeOptions{Quality: quality})
+}
+
+// EncodeWith is like EncodeTo with the encoder settings in opts
+func (r *Result) EncodeWith(w io.Writer, img image.Image, format string, opts EncodeOptions) error {
+	counter := &countingWriter{w: w}
+	if err := EncodeWith(counter, img, format, opts); err != nil {
+		return err
+	}
+
+	bounds := img.Bounds()
+	r.Format = NormalizeFormat(format)
+	r.Width = bounds.Dx()
+	r.Height = bounds.Dy()
+	r.Bytes = counter.n
+	return nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -1,8 +1,13 @@
 package image
 
 import (
+	"fmt"
+	"image"
+	"io/fs"
 	"path/filepath"
 	"strings"
+
+	"github.com/hiroki-abe-58/imgai/pkg/storage"
 )
 
 // GenerateOutputPath generates an output filename based on input and options
@@ -21,9 +26,12 @@ func GenerateOutputPath(inputPath, suffix, extension string) string {
 // NormalizeFormat normalizes format string to lowercase
 func NormalizeFormat(format string) string {
 	format = strings.ToLower(format)
-	// Normalize jpeg to jpg
-	if format == "jpeg" {
+	// Normalize jpeg to jpg and tif to tiff
+	switch format {
+	case "jpeg":
 		return "jpg"
+	case "tif":
+		return "tiff"
 	}
 	return format
 }
@@ -33,3 +41,19 @@ func GetFileExtension(format string) string {
 	format = NormalizeFormat(format)
 	return "." + format
 }
+
+// DecodeConfigFile reads the dimensions and color model of an image file on
+// fsys (nil means the local file system) without decoding its pixels
+func DecodeConfigFile(fsys fs.FS, path string) (image.Config, string, error) {
+	file, err := storage.OpenFile(fsys, path)
+	if err != nil {
+		return image.Config{}, "", fmt.Errorf("%w: %w", ErrOpenFile, err)
+	}
+	defer file.Close()
+
+	cfg, format, err := image.DecodeConfig(file)
+	if err != nil {
+		return image.Config{}, "", fmt.Errorf("%w: %w", ErrDecodeImage, err)
+	}
+	return cfg, format, nil
+}
@@ -1,9 +1,12 @@
 package image
 
 import (
+	"errors"
 	"fmt"
-	"os"
+	"io/fs"
 	"strings"
+
+	"github.com/hiroki-abe-58/imgai/pkg/storage"
 )
 
 // ValidateQuality checks if quality is within valid range
@@ -33,9 +36,10 @@ func ValidateDimensions(width, height int) error {
 	return nil
 }
 
-// ValidateInputFile checks if input file exists and is readable
-func ValidateInputFile(path string) error {
-	if _, err := os.Stat(path); os.IsNotExist(err) {
+// ValidateInputFile checks if input file exists on fsys (nil means the
+// local file system)
+func ValidateInputFile(fsys fs.FS, path string) error {
+	if _, err := storage.StatFile(fsys, path); errors.Is(err, fs.ErrNotExist) {
 		return fmt.Errorf("%w: %s", ErrFileNotFound, path)
 	}
 	return nil
@@ -0,0 +1,647 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"sort"
+)
+
+// MaxWebPSize is the largest width and height of a WebP image
+const MaxWebPSize = 16384
+
+// VP8L transform types and limits
+const (
+	webpPredictorTransform     = 0
+	webpSubtractGreenTransform = 2
+
+	// webpBlockBits sizes the blocks sharing a predictor mode (16x16)
+	webpBlockBits = 4
+
+	webpMaxLength   = 4096
+	webpMaxDistance = 1<<20 - 120
+	webpMinLength   = 3
+	webpHashBits    = 16
+	webpMaxChain    = 16
+
+	webpLengthCodes   = 24
+	webpDistanceCodes = 40
+)
+
+// webpCodeLengthOrder is the order in which code length code lengths are
+// written
+var webpCodeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// webpToken is a literal pixel, or a backward reference when length is set
+type webpToken struct {
+	value  uint32 // the ARGB pixel, or the distance code of a reference
+	length uint16
+}
+
+// encodeWebP writes img as a lossless WebP image. Pixels go through the
+// subtract-green and predictor transforms, then are coded with backward
+// references and a single set of prefix codes.
+func encodeWebP(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 1 || height < 1 || width > MaxWebPSize || height > MaxWebPSize {
+		return fmt.Errorf("%w: WebP images must be 1 to %d pixels wide and high, got %dx%d",
+			ErrEncodeImage, MaxWebPSize, width, height)
+	}
+
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok || nrgba.Rect.Min != (image.Point{}) {
+		nrgba = image.NewNRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(nrgba, nrgba.Rect, img, bounds.Min, draw.Src)
+	}
+	argb := make([]uint32, width*height)
+	alpha := false
+	for y := 0; y < height; y++ {
+		row := nrgba.Pix[y*nrgba.Stride:]
+		for x := 0; x < width; x++ {
+			r, g, b, a := row[4*x], row[4*x+1], row[4*x+2], row[4*x+3]
+			alpha = alpha || a != 0xff
+			// Subtract green
+			argb[y*width+x] = uint32(a)<<24 | uint32(r-g)<<16 | uint32(g)<<8 | uint32(b-g)
+		}
+	}
+
+	bw := &webpBitWriter{}
+	bw.write(0x2f, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	bw.writeBool(alpha)
+	bw.write(0, 3)
+
+	bw.writeBool(true)
+	bw.write(webpSubtractGreenTransform, 2)
+	bw.writeBool(true)
+	bw.write(webpPredictorTransform, 2)
+	bw.write(webpBlockBits-2, 3)
+	modes, modesWidth := webpPredict(argb, width, height)
+	webpWriteImage(bw, modes, modesWidth, false)
+	bw.writeBool(false)
+
+	webpWriteImage(bw, argb, width, true)
+	data := bw.bytes()
+
+	var header bytes.Buffer
+	size := uint32(len(data) + len(data)%2)
+	header.WriteString("RIFF")
+	binary.Write(&header, binary.LittleEndian, 12+size)
+	header.WriteString("WEBPVP8L")
+	binary.Write(&header, binary.LittleEndian, uint32(len(data)))
+	if len(data)%2 == 1 {
+		data = append(data, 0)
+	}
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// webpPredict replaces argb with the residuals of the predictor that fits
+// each block best and returns the image of chosen modes and its width
+func webpPredict(argb []uint32, width, height int) ([]uint32, int) {
+	const block = 1 << webpBlockBits
+	tilesX := (width + block - 1) / block
+	tilesY := (height + block - 1) / block
+	modes := make([]uint32, tilesX*tilesY)
+	residuals := make([]uint32, len(argb))
+
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			best, bestCost := 0, -1
+			for mode := 0; mode < 14; mode++ {
+				cost := 0
+				for y := ty * block; y < min((ty+1)*block, height); y++ {
+					for x := tx * block; x < min((tx+1)*block, width); x++ {
+						cost += webpCost(argb[y*width+x] - webpPrediction(argb, width, x, y, mode))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+			modes[ty*tilesX+tx] = 0xff000000 | uint32(best)<<8
+			for y := ty * block; y < min((ty+1)*block, height); y++ {
+				for x := tx * block; x < min((tx+1)*block, width); x++ {
+					i := y*width + x
+					residuals[i] = webpSub(argb[i], webpPrediction(argb, width, x, y, best))
+				}
+			}
+		}
+	}
+	copy(argb, residuals)
+	return modes, tilesX
+}
+
+// webpPrediction returns the prediction for the pixel at x, y in mode.
+// The first pixel, row and column use fixed modes.
+func webpPrediction(argb []uint32, width, x, y, mode int) uint32 {
+	i := y*width + x
+	switch {
+	case x == 0 && y == 0:
+		return 0xff000000
+	case y == 0:
+		return argb[i-1]
+	case x == 0:
+		return argb[i-width]
+	}
+
+	// The top-right pixel of the last column wraps to the current row
+	l, t, tl, tr := argb[i-1], argb[i-width], argb[i-width-1], argb[i-width+1]
+	switch mode {
+	case 0:
+		return 0xff000000
+	case 1:
+		return l
+	case 2:
+		return t
+	case 3:
+		return tr
+	case 4:
+		return tl
+	case 5:
+		return webpAverage(webpAverage(l, tr), t)
+	case 6:
+		return webpAverage(l, tl)
+	case 7:
+		return webpAverage(l, t)
+	case 8:
+		return webpAverage(tl, t)
+	case 9:
+		return webpAverage(t, tr)
+	case 10:
+		return webpAverage(webpAverage(l, tl), webpAverage(t, tr))
+	case 11:
+		if webpDistance(t, tl) < webpDistance(l, tl) {
+			return l
+		}
+		return t
+	case 12:
+		return webpChannels(func(shift uint) uint32 {
+			return webpClamp(webpChannel(l, shift) + webpChannel(t, shift) - webpChannel(tl, shift))
+		})
+	default:
+		avg := webpAverage(l, t)
+		return webpChannels(func(shift uint) uint32 {
+			a := webpChannel(avg, shift)
+			return webpClamp(a + (a-webpChannel(tl, shift))/2)
+		})
+	}
+}
+
+// webpChannel returns the channel of p at shift
+func webpChannel(p uint32, shift uint) int {
+	return int(p >> shift & 0xff)
+}
+
+// webpChannels builds a pixel from the channel values returned by f
+func webpChannels(f func(shift uint) uint32) uint32 {
+	return f(24)<<24 | f(16)<<16 | f(8)<<8 | f(0)
+}
+
+// webpClamp clamps v to a channel value
+func webpClamp(v int) uint32 {
+	return uint32(max(0, min(255, v)))
+}
+
+// webpAverage returns the per-channel floor average of a and b
+func webpAverage(a, b uint32) uint32 {
+	return (a^b)&0xfefefefe>>1 + a&b
+}
+
+// webpSub returns the per-channel difference a - b modulo 256
+func webpSub(a, b uint32) uint32 {
+	return webpChannels(func(shift uint) uint32 {
+		return uint32(uint8(webpChannel(a, shift) - webpChannel(b, shift)))
+	})
+}
+
+// webpDistance returns the sum of the per-channel distances of a and b
+func webpDistance(a, b uint32) int {
+	d := 0
+	for shift := uint(0); shift < 32; shift += 8 {
+		d += abs(webpChannel(a, shift) - webpChannel(b, shift))
+	}
+	return d
+}
+
+// webpCost estimates how well a residual compresses: small values in each
+// channel, taken as signed, are cheaper
+func webpCost(residual uint32) int {
+	cost := 0
+	for shift := uint(0); shift < 32; shift += 8 {
+		cost += abs(int(int8(residual >> shift)))
+	}
+	return cost
+}
+
+// abs returns the absolute value of v
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// webpWriteImage writes an entropy-coded image without a color cache. Only
+// the main image carries the bit that would select several prefix code
+// groups.
+func webpWriteImage(bw *webpBitWriter, argb []uint32, width int, main bool) {
+	tokens := webpBackwardReferences(argb, width)
+
+	green := make([]int, 256+webpLengthCodes)
+	red := make([]int, 256)
+	blue := make([]int, 256)
+	alpha := make([]int, 256)
+	distance := make([]int, webpDistanceCodes)
+	for _, token := range tokens {
+		if token.length > 0 {
+			code, _, _ := webpPrefix(uint32(token.length))
+			green[256+code]++
+			code, _, _ = webpPrefix(token.value)
+			distance[code]++
+			continue
+		}
+		green[token.value>>8&0xff]++
+		red[token.value>>16&0xff]++
+		blue[token.value&0xff]++
+		alpha[token.value>>24]++
+	}
+
+	bw.writeBool(false)
+	if main {
+		bw.writeBool(false)
+	}
+	codes := make([]webpCode, 5)
+	for i, histogram := range [][]int{green, red, blue, alpha, distance} {
+		codes[i] = webpWriteCode(bw, histogram)
+	}
+
+	for _, token := range tokens {
+		if token.length > 0 {
+			code, bits, extra := webpPrefix(uint32(token.length))
+			codes[0].write(bw, 256+code)
+			bw.write(extra, bits)
+			code, bits, extra = webpPrefix(token.value)
+			codes[4].write(bw, code)
+			bw.write(extra, bits)
+			continue
+		}
+		codes[0].write(bw, int(token.value>>8&0xff))
+		codes[1].write(bw, int(token.value>>16&0xff))
+		codes[2].write(bw, int(token.value&0xff))
+		codes[3].write(bw, int(token.value>>24))
+	}
+}
+
+// webpBackwardReferences splits argb into literals and greedy backward
+// references, found among the previous pixel, the pixel above and a short
+// hash chain of earlier pixel pairs
+func webpBackwardReferences(argb []uint32, width int) []webpToken {
+	n := len(argb)
+	head := make([]int32, 1<<webpHashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	chain := make([]int32, n)
+	hash := func(i int) uint32 {
+		return (argb[i]*0x1e35a7bd ^ argb[i+1]*0x9e3779b1) >> (32 - webpHashBits)
+	}
+	insert := func(i int) {
+		if i+1 < n {
+			h := hash(i)
+			chain[i] = head[h]
+			head[h] = int32(i)
+		}
+	}
+	match := func(i, j int) int {
+		length := 0
+		for i+length < n && length < webpMaxLength && argb[i+length] == argb[j+length] {
+			length++
+		}
+		return length
+	}
+
+	tokens := make([]webpToken, 0, n/2)
+	for i := 0; i < n; {
+		bestLength, bestDistance := 0, 0
+		try := func(j int) {
+			if j < 0 || i-j > webpMaxDistance {
+				return
+			}
+			if length := match(i, j); length > bestLength {
+				bestLength, bestDistance = length, i-j
+			}
+		}
+		try(i - 1)
+		try(i - width)
+		if i+1 < n {
+			j := head[hash(i)]
+			for k := 0; j >= 0 && k < webpMaxChain; k++ {
+				try(int(j))
+				j = chain[j]
+			}
+		}
+
+		if bestLength < webpMinLength {
+			tokens = append(tokens, webpToken{value: argb[i]})
+			insert(i)
+			i++
+			continue
+		}
+		tokens = append(tokens, webpToken{value: webpDistanceCode(bestDistance, width), length: uint16(bestLength)})
+		for k := 0; k < bestLength; k++ {
+			insert(i + k)
+		}
+		i += bestLength
+	}
+	return tokens
+}
+
+// webpDistanceCode maps a distance to its code: the short codes for the
+// previous pixel and the one above, otherwise the distance plus 120
+func webpDistanceCode(distance, width int) uint32 {
+	switch distance {
+	case width:
+		return 1
+	case 1:
+		return 2
+	}
+	return uint32(distance + 120)
+}
+
+// webpPrefix returns the prefix code of a length or distance code value and
+// its extra bits
+func webpPrefix(value uint32) (code int, bits uint, extra uint32) {
+	if value < 5 {
+		return int(value - 1), 0, 0
+	}
+	value--
+	highest := uint(31)
+	for value>>highest == 0 {
+		highest--
+	}
+	second := value >> (highest - 1) & 1
+	bits = highest - 1
+	return int(2*highest + uint(second)), bits, value & (1<<bits - 1)
+}
+
+// webpCode is a canonical prefix code, stored bit-reversed for writing
+type webpCode struct {
+	lengths []uint8
+	codes   []uint32
+}
+
+// write writes symbol with the code
+func (c webpCode) write(bw *webpBitWriter, symbol int) {
+	bw.write(c.codes[symbol], uint(c.lengths[symbol]))
+}
+
+// webpWriteCode writes a prefix code for histogram and returns it. Codes
+// for at most one symbol below 256 use the simple form and take no bits.
+func webpWriteCode(bw *webpBitWriter, histogram []int) webpCode {
+	used := 0
+	symbol := 0
+	for s, count := range histogram {
+		if count > 0 {
+			used++
+			symbol = s
+		}
+	}
+	if used <= 1 && symbol < 256 {
+		bw.writeBool(true)
+		bw.write(0, 1)
+		if symbol < 2 {
+			bw.write(0, 1)
+			bw.write(uint32(symbol), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(symbol), 8)
+		}
+		return webpCode{lengths: make([]uint8, len(histogram)), codes: make([]uint32, len(histogram))}
+	}
+
+	code := webpBuildCode(histogram, 15)
+	bw.writeBool(false)
+
+	// Code lengths are run-length coded with symbols 16 (repeat the
+	// previous length), 17 and 18 (runs of zeros)
+	type run struct {
+		symbol int
+		extra  uint32
+		bits   uint
+	}
+	var runs []run
+	lengths := code.lengths
+	previous := uint8(8)
+	for i := 0; i < len(lengths); {
+		length := lengths[i]
+		n := 1
+		for i+n < len(lengths) && lengths[i+n] == length {
+			n++
+		}
+		i += n
+		if length == 0 {
+			for n >= 11 {
+				k := min(n, 138)
+				runs = append(runs, run{18, uint32(k - 11), 7})
+				n -= k
+			}
+			if n >= 3 {
+				runs = append(runs, run{17, uint32(n - 3), 3})
+				n = 0
+			}
+			for ; n > 0; n-- {
+				runs = append(runs, run{0, 0, 0})
+			}
+			continue
+		}
+		if length != previous {
+			runs = append(runs, run{int(length), 0, 0})
+			n--
+			previous = length
+		}
+		for n >= 3 {
+			k := min(n, 6)
+			runs = append(runs, run{16, uint32(k - 3), 2})
+			n -= k
+		}
+		for ; n > 0; n-- {
+			runs = append(runs, run{int(length), 0, 0})
+		}
+	}
+
+	counts := make([]int, 19)
+	for _, r := range runs {
+		counts[r.symbol]++
+	}
+	lengthCode := webpBuildCode(counts, 7)
+	last := 4
+	for i, s := range webpCodeLengthOrder {
+		if lengthCode.lengths[s] > 0 {
+			last = max(last, i+1)
+		}
+	}
+	bw.write(uint32(last-4), 4)
+	for _, s := range webpCodeLengthOrder[:last] {
+		bw.write(uint32(lengthCode.lengths[s]), 3)
+	}
+	bw.writeBool(false)
+	for _, r := range runs {
+		lengthCode.write(bw, r.symbol)
+		bw.write(r.extra, r.bits)
+	}
+	return code
+}
+
+// webpBuildCode builds a canonical prefix code of at most maxLength bits
+// for histogram. At least two symbols get a code, as decoders require of
+// codes written in full.
+func webpBuildCode(histogram []int, maxLength int) webpCode {
+	counts := append([]int(nil), histogram...)
+	used := 0
+	for _, count := range counts {
+		if count > 0 {
+			used++
+		}
+	}
+	for s := 0; used < 2; s++ {
+		if counts[s] == 0 {
+			counts[s] = 1
+			used++
+		}
+	}
+
+	lengths := webpCodeLengths(counts)
+	for webpMaxOf(lengths) > maxLength {
+		// Flatten the distribution until the tree is shallow enough
+		for s, count := range counts {
+			if count > 0 {
+				counts[s] = max(1, count/2)
+			}
+		}
+		lengths = webpCodeLengths(counts)
+	}
+
+	code := webpCode{lengths: lengths, codes: make([]uint32, len(lengths))}
+	var next [16]uint32
+	var numbers [16]uint32
+	for _, length := range lengths {
+		numbers[length]++
+	}
+	numbers[0] = 0
+	for bits := 1; bits < 16; bits++ {
+		next[bits] = (next[bits-1] + numbers[bits-1]) << 1
+	}
+	for s, length := range lengths {
+		if length == 0 {
+			continue
+		}
+		c := next[length]
+		next[length]++
+		reversed := uint32(0)
+		for i := uint8(0); i < length; i++ {
+			reversed = reversed<<1 | c>>i&1
+		}
+		code.codes[s] = reversed
+	}
+	return code
+}
+
+// webpCodeLengths returns the Huffman code lengths for counts, with zero
+// for unused symbols
+func webpCodeLengths(counts []int) []uint8 {
+	type node struct {
+		count       int
+		parent      int
+		left, right int
+	}
+	var nodes []node
+	for s, count := range counts {
+		if count > 0 {
+			nodes = append(nodes, node{count: count, parent: -1, left: -1, right: s})
+		}
+	}
+	leaves := len(nodes)
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].count < nodes[j].count })
+
+	// Two-queue construction: leaves sorted by count, then merged nodes
+	// in the order they are made, which is also by count
+	next, merged := 0, leaves
+	pick := func() int {
+		if next < leaves && (merged >= len(nodes) || nodes[next].count <= nodes[merged].count) {
+			next++
+			return next - 1
+		}
+		merged++
+		return merged - 1
+	}
+	for i := 0; i < leaves-1; i++ {
+		a, b := pick(), pick()
+		nodes = append(nodes, node{count: nodes[a].count + nodes[b].count, parent: -1, left: a, right: b})
+		nodes[a].parent = len(nodes) - 1
+		nodes[b].parent = len(nodes) - 1
+	}
+
+	lengths := make([]uint8, len(counts))
+	for i := 0; i < leaves; i++ {
+		depth := 0
+		for p := nodes[i].parent; p >= 0; p = nodes[p].parent {
+			depth++
+		}
+		lengths[nodes[i].right] = uint8(min(depth, 255))
+	}
+	return lengths
+}
+
+// webpMaxOf returns the largest of lengths
+func webpMaxOf(lengths []uint8) int {
+	m := 0
+	for _, length := range lengths {
+		m = max(m, int(length))
+	}
+	return m
+}
+
+// webpBitWriter writes values least significant bit first
+type webpBitWriter struct {
+	buf   []byte
+	bits  uint64
+	nbits uint
+}
+
+// write appends the low n bits of v
+func (b *webpBitWriter) write(v uint32, n uint) {
+	b.bits |= uint64(v&(1<<n-1)) << b.nbits
+	b.nbits += n
+	for b.nbits >= 8 {
+		b.buf = append(b.buf, byte(b.bits))
+		b.bits >>= 8
+		b.nbits -= 8
+	}
+}
+
+// writeBool appends a single bit
+func (b *webpBitWriter) writeBool(v bool) {
+	if v {
+		b.write(1, 1)
+	} else {
+		b.write(0, 1)
+	}
+}
+
+// bytes returns the written data, padded to a whole byte
+func (b *webpBitWriter) bytes() []byte {
+	if b.nbits > 0 {
+		b.buf = append(b.buf, byte(b.bits))
+		b.bits, b.nbits = 0, 0
+	}
+	return b.buf
+}
@@ -0,0 +1,53 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/hiroki-abe-58/imgai/pkg/storage"
+)
+
+// WriteFileAtomic writes path on fsys (nil means the local file system) by
+// encoding into a storage.Writer that only replaces path when committed.
+// An existing file keeps its permissions when fsys can also be read.
+// If ctx is done before the commit, the write is discarded and any existing
+// file at path is left intact.
+func WriteFileAtomic(ctx context.Context, fsys storage.WriteFS, path string, encode func(w io.Writer) error) error {
+	w, err := storage.CreateFile(fsys, path, outputMode(fsys, path))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSaveImage, err)
+	}
+
+	if err := encode(w); err != nil {
+		w.Abort()
+		return fmt.Errorf("%w: %w", ErrEncodeImage, err)
+	}
+
+	// Last chance to roll back before the destination is replaced
+	if err := ctx.Err(); err != nil {
+		w.Abort()
+		return err
+	}
+
+	if err := w.Commit(); err != nil {
+		return fmt.Errorf("%w: %w", ErrSaveImage, err)
+	}
+	return nil
+}
+
+// outputMode returns the mode of an existing file at path, or 0644
+func outputMode(fsys storage.WriteFS, path string) fs.FileMode {
+	var rfs fs.FS
+	if fsys != nil {
+		var ok bool
+		if rfs, ok = fsys.(fs.FS); !ok {
+			return 0o644
+		}
+	}
+	if info, err := storage.StatFile(rfs, path); err == nil {
+		return info.Mode().Perm()
+	}
+	return 0o644
+}
@@ -2,15 +2,17 @@ package metadata
 
 import (
 	"fmt"
-	"os"
+	"io/fs"
 	"strings"
 
+	"github.com/hiroki-abe-58/imgai/pkg/storage"
 	"github.com/rwcarlsen/goexif/exif"
 )
 
-// ReadExif reads EXIF data from an image file
-func ReadExif(path string) (*ExifData, error) {
-	file, err := os.Open(path)
+// ReadExif reads EXIF data from an image file on fsys (nil means the local
+// file system)
+func ReadExif(fsys fs.FS, path string) (*ExifData, error) {
+	file, err := storage.OpenFile(fsys, path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
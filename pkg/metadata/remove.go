@@ -1,29 +1,64 @@
 package metadata
 
 import (
+	"context"
 	"fmt"
+	"io"
 
-	"github.com/disintegration/imaging"
+	"github.com/hiroki-abe-58/imgai/pkg/image"
 )
 
-// StripExif removes all EXIF metadata from an image
-func StripExif(inputPath string, opts StripOptions) error {
+// StripExif removes all EXIF metadata from an image file
+// and returns a Result describing the written file
+func StripExif(ctx context.Context, inputPath string, opts StripOptions) (image.Result, error) {
 	// Open the image
-	img, err := imaging.Open(inputPath)
+	img, inputFormat, err := image.OpenImage(opts.FS, inputPath, opts.Limits)
 	if err != nil {
-		return fmt.Errorf("failed to open image: %w", err)
+		return image.Result{}, fmt.Errorf("failed to open image: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return image.Result{}, err
 	}
 
 	// Determine output path
 	outputPath := getOutputPath(inputPath, opts.Output)
 
 	// Save the image without metadata
-	if err := imaging.Save(img, outputPath); err != nil {
-		return fmt.Errorf("failed to save image: %w", err)
+	format, err := image.FormatFromPath(outputPath)
+	if err != nil {
+		return image.Result{}, fmt.Errorf("failed to save image: %w", err)
+	}
+	result := image.NewResult(img, inputFormat)
+	result.Path = outputPath
+	encode := func(w io.Writer) error {
+		return result.EncodeTo(w, img, format, 0)
+	}
+	if err := image.WriteFileAtomic(ctx, opts.Out, outputPath, encode); err != nil {
+		return image.Result{}, fmt.Errorf("failed to save image: %w", err)
+	}
+
+	return result, nil
+}
+
+// StripStream decodes an image from r and re-encodes it to w without
+// metadata, in format or in the input format when format is empty
+func StripStream(ctx context.Context, r io.Reader, w io.Writer, format string, opts StripOptions) (image.Result, error) {
+	img, inputFormat, err := image.Decode(r, opts.Limits)
+	if err != nil {
+		return image.Result{}, fmt.Errorf("failed to open image: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return image.Result{}, err
 	}
 
-	fmt.Printf("✓ Stripped metadata: %s\n", outputPath)
-	return nil
+	if format == "" {
+		format = inputFormat
+	}
+	result := image.NewResult(img, inputFormat)
+	if err := result.EncodeTo(w, img, format, 0); err != nil {
+		return image.Result{}, fmt.Errorf("failed to save image: %w: %w", image.ErrEncodeImage, err)
+	}
+	return result, nil
 }
 
 // getOutputPath returns the appropriate output path
@@ -1,5 +1,12 @@
 package metadata
 
+import (
+	"io/fs"
+
+	"github.com/hiroki-abe-58/imgai/pkg/image"
+	"github.com/hiroki-abe-58/imgai/pkg/storage"
+)
+
 // ExifData holds important EXIF information
 type ExifData struct {
 	Make         string
@@ -24,6 +31,12 @@ type GPSData struct {
 // StripOptions holds options for stripping metadata
 type StripOptions struct {
 	Output string
+	Limits image.Limits `json:"-"`
+
+	// FS holds the input file and Out receives the output file (nil means
+	// the local file system, addressed with native paths)
+	FS  fs.FS           `json:"-"`
+	Out storage.WriteFS `json:"-"`
 }
 
 // HasGPS returns true if GPS data is available
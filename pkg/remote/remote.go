@@ -0,0 +1,223 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hiroki-abe-58/imgai/pkg/image"
+	"github.com/hiroki-abe-58/imgai/pkg/storage"
+)
+
+const (
+	// DefaultMaxSize bounds downloads when no size limit is configured
+	DefaultMaxSize = 100 << 20
+
+	// DefaultTimeout bounds a single download
+	DefaultTimeout = 30 * time.Second
+
+	// DefaultConcurrency is the number of downloads run at once
+	DefaultConcurrency = 4
+)
+
+var (
+	// ErrFetch indicates that a remote image could not be downloaded
+	ErrFetch = errors.New("failed to fetch image")
+
+	// ErrContentType indicates that the server returned something other
+	// than an image
+	ErrContentType = errors.New("unexpected content type")
+)
+
+// IsURL returns true if input is an http or https URL
+func IsURL(input string) bool {
+	lower := strings.ToLower(input)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// Config configures a Fetcher
+type Config struct {
+	// Client performs the requests; nil uses http.DefaultClient. Tests and
+	// local stand-ins for a CDN can supply their own transport here.
+	Client *http.Client
+
+	// MaxSize rejects responses larger than this many bytes
+	// (0 means DefaultMaxSize)
+	MaxSize int64
+
+	// Timeout bounds each download including the body (0 means DefaultTimeout)
+	Timeout time.Duration
+
+	// Concurrency bounds the downloads run at once (0 means DefaultConcurrency)
+	Concurrency int
+}
+
+// Fetcher downloads remote images to local files so they can be processed
+// like any other input
+type Fetcher struct {
+	config Config
+	slots  chan struct{}
+}
+
+// Download is a fetched image stored in its own temporary directory
+type Download struct {
+	// Path is the downloaded file, named after the last URL path segment
+	Path string
+
+	dir string
+}
+
+// Dir returns the temporary directory holding the download
+func (d *Download) Dir() string {
+	return d.dir
+}
+
+// Remove deletes the download and its temporary directory
+func (d *Download) Remove() error {
+	return os.RemoveAll(d.dir)
+}
+
+// NewFetcher creates a Fetcher for config
+func NewFetcher(config Config) *Fetcher {
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	if config.MaxSize <= 0 {
+		config.MaxSize = DefaultMaxSize
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = DefaultConcurrency
+	}
+	return &Fetcher{
+		config: config,
+		slots:  make(chan struct{}, config.Concurrency),
+	}
+}
+
+// Fetch downloads rawURL into a new temporary directory below dir (empty
+// means os.TempDir). The response must succeed, fit in the configured size
+// and carry an image or application/octet-stream content type. The latter
+// is what many servers send for any file, so Fetch accepts it and relies on
+// the decoder sniffing the downloaded bytes to reject non-images.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL, dir string) (*Download, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || !IsURL(rawURL) || u.Host == "" {
+		return nil, fmt.Errorf("%w: invalid URL %s", ErrFetch, rawURL)
+	}
+
+	select {
+	case f.slots <- struct{}{}:
+		defer func() { <-f.slots }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, f.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFetch, err)
+	}
+	req.Header.Set("Accept", "image/*")
+	req.Header.Set("User-Agent", "imgai")
+
+	resp, err := f.config.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFetch, err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp, f.config.MaxSize); err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.MkdirTemp(dir, ".imgai-fetch-")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFetch, err)
+	}
+	tmp = filepath.Clean(tmp)
+	download := &Download{Path: filepath.Join(tmp, fileName(u)), dir: tmp}
+	if err := download.save(resp.Body, f.config.MaxSize); err != nil {
+		download.Remove()
+		return nil, err
+	}
+	return download, nil
+}
+
+// checkResponse rejects failed, non-image and oversized responses
+func checkResponse(resp *http.Response, maxSize int64) error {
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("%w: %s", ErrFetch, resp.Status)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			err = fmt.Errorf("%w: %w", storage.ErrUnavailable, err)
+		}
+		return err
+	}
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (!strings.HasPrefix(mediaType, "image/") && mediaType != "application/octet-stream") {
+			return fmt.Errorf("%w: %s", ErrContentType, contentType)
+		}
+	}
+
+	if resp.ContentLength > maxSize {
+		return &image.LimitError{Limit: "file size", Value: resp.ContentLength, Max: maxSize}
+	}
+	return nil
+}
+
+// save copies body to the download path, failing once maxSize is exceeded,
+// and adds an extension from the sniffed format if the name lacks one
+func (d *Download) save(body io.Reader, maxSize int64) error {
+	file, err := os.Create(d.Path)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFetch, err)
+	}
+	n, err := io.Copy(file, io.LimitReader(body, maxSize+1))
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFetch, err)
+	}
+	if n > maxSize {
+		return &image.LimitError{Limit: "file size", Value: n, Max: maxSize}
+	}
+
+	if ext := strings.TrimPrefix(filepath.Ext(d.Path), "."); ext != "" && image.ValidateFormat(ext) == nil {
+		return nil
+	}
+	_, format, err := image.DecodeConfigFile(nil, d.Path)
+	if err != nil {
+		return err
+	}
+	named := d.Path + image.GetFileExtension(format)
+	if err := os.Rename(d.Path, named); err != nil {
+		return fmt.Errorf("%w: %w", ErrFetch, err)
+	}
+	d.Path = named
+	return nil
+}
+
+// fileName derives a local file name from the last segment of the URL path
+func fileName(u *url.URL) string {
+	name := path.Base(u.Path)
+	if name == "/" || name == "." || name == "" || strings.HasPrefix(name, ".") {
+		return "image"
+	}
+	return name
+}
@@ -0,0 +1,170 @@
+package report
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+
+	"github.com/hiroki-abe-58/imgai/pkg/batch"
+	"github.com/hiroki-abe-58/imgai/pkg/image"
+)
+
+// Status values for a record
+const (
+	StatusOK       = "ok"
+	StatusSkipped  = "skipped"
+	StatusFailed   = "failed"
+	StatusCanceled = "canceled"
+)
+
+// Record describes the outcome of processing a single file
+type Record struct {
+	Input            string  `json:"input"`
+	Output           string  `json:"output,omitempty"`
+	Status           string  `json:"status"`
+	OriginalWidth    int     `json:"original_width,omitempty"`
+	OriginalHeight   int     `json:"original_height,omitempty"`
+	Width            int     `json:"width,omitempty"`
+	Height           int     `json:"height,omitempty"`
+	InputBytes       int64   `json:"input_bytes,omitempty"`
+	OutputBytes      int64   `json:"output_bytes,omitempty"`
+	CompressionRatio float64 `json:"compression_ratio,omitempty"`
+	DurationMS       float64 `json:"duration_ms"`
+	ErrorCode        string  `json:"error_code,omitempty"`
+	Error            string  `json:"error,omitempty"`
+}
+
+// fileInfo holds the size and dimensions of a file
+type fileInfo struct {
+	bytes  int64
+	width  int
+	height int
+}
+
+// Collector gathers the information needed to build records. Input details
+// are captured before processing because some operations overwrite inputs.
+type Collector struct {
+	mu     sync.Mutex
+	inputs map[string]fileInfo
+}
+
+// NewCollector creates an empty collector
+func NewCollector() *Collector {
+	return &Collector{inputs: make(map[string]fileInfo)}
+}
+
+// Wrap returns a ProcessFunc that records input details before calling fn
+func (c *Collector) Wrap(fn batch.ProcessFunc) batch.ProcessFunc {
+	return func(ctx context.Context, path string) (string, error) {
+		c.captureInput(path)
+		return fn(ctx, path)
+	}
+}
+
+// Records builds one record per result, in the order of results
+func (c *Collector) Records(results []batch.Result) []Record {
+	records := make([]Record, 0, len(results))
+	for _, result := range results {
+		records = append(records, c.record(result))
+	}
+	return records
+}
+
+// captureInput stores the details of path as it is before processing
+func (c *Collector) captureInput(path string) {
+	info := inspect(path)
+	c.mu.Lock()
+	c.inputs[path] = info
+	c.mu.Unlock()
+}
+
+// record builds a record for a single result
+func (c *Collector) record(result batch.Result) Record {
+	rec := Record{
+		Input:      result.Path,
+		Output:     result.Output,
+		DurationMS: float64(result.Duration.Microseconds()) / 1000,
+	}
+
+	switch {
+	case result.Skipped:
+		rec.Status = StatusSkipped
+	case result.Success:
+		rec.Status = StatusOK
+	case errors.Is(result.Error, context.Canceled), errors.Is(result.Error, batch.ErrAborted):
+		rec.Status = StatusCanceled
+	default:
+		rec.Status = StatusFailed
+	}
+	if result.Error != nil {
+		rec.ErrorCode = ErrorCode(result.Error)
+		rec.Error = result.Error.Error()
+	}
+
+	// Skipped files were never captured, but their inputs are unchanged
+	c.mu.Lock()
+	in, ok := c.inputs[result.Path]
+	c.mu.Unlock()
+	if !ok {
+		in = inspect(result.Path)
+	}
+	rec.InputBytes = in.bytes
+	rec.OriginalWidth = in.width
+	rec.OriginalHeight = in.height
+
+	if result.Success && result.Output != "" {
+		out := inspect(result.Output)
+		rec.OutputBytes = out.bytes
+		rec.Width = out.width
+		rec.Height = out.height
+		if in.bytes > 0 && out.bytes > 0 {
+			rec.CompressionRatio = float64(out.bytes) / float64(in.bytes)
+		}
+	}
+	return rec
+}
+
+// inspect reads the size and dimensions of a file, ignoring errors
+func inspect(path string) fileInfo {
+	var info fileInfo
+	if stat, err := os.Stat(path); err == nil {
+		info.bytes = stat.Size()
+	}
+	if cfg, _, err := image.DecodeConfigFile(nil, path); err == nil {
+		info.width = cfg.Width
+		info.height = cfg.Height
+	}
+	return info
+}
+
+// ErrorCode maps an error to a stable, machine-readable code
+func ErrorCode(err error) string {
+	var limitErr *image.LimitError
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, batch.ErrAborted):
+		return "aborted"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &limitErr):
+		return "limit_exceeded"
+	case errors.Is(err, image.ErrFileNotFound):
+		return "not_found"
+	case errors.Is(err, image.ErrInvalidFormat):
+		return "invalid_format"
+	case errors.Is(err, image.ErrOpenFile):
+		return "open_failed"
+	case errors.Is(err, image.ErrDecodeImage):
+		return "decode_failed"
+	case errors.Is(err, image.ErrEncodeImage):
+		return "encode_failed"
+	case errors.Is(err, image.ErrSaveImage):
+		return "save_failed"
+	default:
+		return "error"
+	}
+}
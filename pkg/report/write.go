@@ -0,0 +1,106 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Supported report formats
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// Summary aggregates the records of a run
+type Summary struct {
+	Command   string   `json:"command"`
+	Total     int      `json:"total"`
+	Succeeded int      `json:"succeeded"`
+	Skipped   int      `json:"skipped"`
+	Failed    int      `json:"failed"`
+	Canceled  int      `json:"canceled"`
+	Files     []Record `json:"files"`
+}
+
+// ValidateFormat checks that format is a supported report format
+func ValidateFormat(format string) error {
+	if format != FormatJSON && format != FormatCSV {
+		return fmt.Errorf("unsupported report format: %s (supported: json, csv)", format)
+	}
+	return nil
+}
+
+// Summarize builds a summary of records for command
+func Summarize(command string, records []Record) Summary {
+	summary := Summary{Command: command, Total: len(records), Files: records}
+	for _, rec := range records {
+		switch rec.Status {
+		case StatusOK:
+			summary.Succeeded++
+		case StatusSkipped:
+			summary.Succeeded++
+			summary.Skipped++
+		case StatusCanceled:
+			summary.Canceled++
+		default:
+			summary.Failed++
+		}
+	}
+	return summary
+}
+
+// Write writes the summary to w in the given format
+func Write(w io.Writer, format string, summary Summary) error {
+	switch format {
+	case FormatJSON:
+		return writeJSON(w, summary)
+	case FormatCSV:
+		return writeCSV(w, summary.Files)
+	default:
+		return ValidateFormat(format)
+	}
+}
+
+// writeJSON writes the summary as an indented JSON document
+func writeJSON(w io.Writer, summary Summary) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(summary)
+}
+
+// csvHeader lists the CSV columns in order
+var csvHeader = []string{
+	"input", "output", "status",
+	"original_width", "original_height", "width", "height",
+	"input_bytes", "output_bytes", "compression_ratio",
+	"duration_ms", "error_code", "error",
+}
+
+// writeCSV writes one row per record with a header line
+func writeCSV(w io.Writer, records []Record) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, rec := range records {
+		row := []string{
+			rec.Input, rec.Output, rec.Status,
+			strconv.Itoa(rec.OriginalWidth), strconv.Itoa(rec.OriginalHeight),
+			strconv.Itoa(rec.Width), strconv.Itoa(rec.Height),
+			strconv.FormatInt(rec.InputBytes, 10), strconv.FormatInt(rec.OutputBytes, 10),
+			strconv.FormatFloat(rec.CompressionRatio, 'f', 4, 64),
+			strconv.FormatFloat(rec.DurationMS, 'f', 3, 64),
+			rec.ErrorCode, rec.Error,
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/hiroki-abe-58/imgai/pkg/image"
+)
+
+// contentTypes maps output formats to their media types
+var contentTypes = map[string]string{
+	"jpg":  "image/jpeg",
+	"png":  "image/png",
+	"webp": "image/webp",
+	"gif":  "image/gif",
+	"bmp":  "image/bmp",
+	"tiff": "image/tiff",
+}
+
+// negotiateFormat picks the output format when the request names none:
+// WebP for clients that accept it, and otherwise the source format, or
+// JPEG for sources the server cannot encode
+func negotiateFormat(accept, source string) string {
+	if accepts(accept, contentTypes["webp"]) {
+		return "webp"
+	}
+	if _, ok := contentTypes[source]; ok {
+		return source
+	}
+	return image.DefaultFormat
+}
+
+// accepts returns true if the Accept header lists mediaType explicitly
+// with a non-zero quality. Wildcards are ignored so that newer formats are
+// only sent to clients that advertise them.
+func accepts(header, mediaType string) bool {
+	for _, part := range strings.Split(header, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mt != mediaType {
+			continue
+		}
+		if q, ok := params["q"]; ok {
+			if v, err := strconv.ParseFloat(q, 64); err != nil || v <= 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/hiroki-abe-58/imgai/pkg/image"
+)
+
+// Operations supported in request paths
+const (
+	OpResize  = "resize"
+	OpConvert = "convert"
+)
+
+// ErrInvalidParams is returned for malformed processing paths
+var ErrInvalidParams = errors.New("invalid processing options")
+
+// Params are the processing options parsed from a request path such as
+// /resize/w:800/q:80/format:png/photos/cat.jpg
+type Params struct {
+	Op      string
+	Width   int
+	Height  int
+	Quality int
+
+	// Format is the requested output format; empty negotiates it from
+	// the Accept header and the source format
+	Format string
+
+	// Path is the source image relative to the root, slash-separated
+	Path string
+}
+
+// ParseParams parses a request path of the form
+// /<op>/<key>:<value>/.../<source path>
+func ParseParams(urlPath string) (Params, error) {
+	segments := strings.Split(strings.TrimPrefix(urlPath, "/"), "/")
+	if len(segments) < 2 {
+		return Params{}, fmt.Errorf("%w: expected /<operation>/<options>/<path>", ErrInvalidParams)
+	}
+
+	p := Params{Op: segments[0]}
+	if p.Op != OpResize && p.Op != OpConvert {
+		return Params{}, fmt.Errorf("%w: unknown operation %q", ErrInvalidParams, p.Op)
+	}
+
+	i := 1
+	for ; i < len(segments); i++ {
+		key, value, ok := strings.Cut(segments[i], ":")
+		if !ok {
+			break
+		}
+		if err := p.set(key, value); err != nil {
+			return Params{}, err
+		}
+	}
+
+	p.Path = strings.Join(segments[i:], "/")
+	if err := validatePath(p.Path); err != nil {
+		return Params{}, err
+	}
+	return p, p.validate()
+}
+
+// ParsePreset parses an operation and options without a source path, such
+// as "resize/w:800/q:80", for use in an allow-list
+func ParsePreset(preset string) (Params, error) {
+	p, err := ParseParams("/" + strings.Trim(preset, "/") + "/_")
+	if err != nil {
+		return Params{}, err
+	}
+	p.Path = ""
+	return p, nil
+}
+
+// validatePath rejects source paths that could escape the root or reach
+// hidden files: empty, ".." or hidden segments, backslashes and NUL bytes
+func validatePath(p string) error {
+	if p == "" {
+		return fmt.Errorf("%w: missing source path", ErrInvalidParams)
+	}
+	if strings.ContainsAny(p, "\\\x00") {
+		return fmt.Errorf("%w: invalid character in source path", ErrInvalidParams)
+	}
+	for _, segment := range strings.Split(p, "/") {
+		if segment == "" || strings.HasPrefix(segment, ".") {
+			return fmt.Errorf("%w: invalid source path segment %q", ErrInvalidParams, segment)
+		}
+	}
+	return nil
+}
+
+// set applies a single key:value option
+func (p *Params) set(key, value string) error {
+	switch key {
+	case "format":
+		p.Format = image.NormalizeFormat(value)
+		if _, ok := contentTypes[p.Format]; !ok {
+			return fmt.Errorf("%w: unsupported output format %q", ErrInvalidParams, value)
+		}
+		return nil
+	case "w", "h", "q":
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("%w: %s must be a positive integer", ErrInvalidParams, key)
+		}
+		switch key {
+		case "w":
+			p.Width = n
+		case "h":
+			p.Height = n
+		default:
+			p.Quality = n
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown option %q", ErrInvalidParams, key)
+	}
+}
+
+// validate checks the options required by the operation
+func (p Params) validate() error {
+	switch p.Op {
+	case OpResize:
+		if err := image.ValidateDimensions(p.Width, p.Height); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidParams, err)
+		}
+	case OpConvert:
+		if p.Format == "" {
+			return fmt.Errorf("%w: convert requires format", ErrInvalidParams)
+		}
+		if p.Width > 0 || p.Height > 0 {
+			return fmt.Errorf("%w: convert does not take w or h", ErrInvalidParams)
+		}
+	}
+	if p.Format != "" {
+		if err := image.ValidateFormat(p.Format); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidParams, err)
+		}
+	}
+	if p.Quality > 0 {
+		if err := image.ValidateQuality(p.Quality); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidParams, err)
+		}
+	}
+	return nil
+}
+
+// Options returns the options in canonical order, e.g. "w:800/q:80/format:png"
+func (p Params) Options() string {
+	var opts []string
+	if p.Width > 0 {
+		opts = append(opts, "w:"+strconv.Itoa(p.Width))
+	}
+	if p.Height > 0 {
+		opts = append(opts, "h:"+strconv.Itoa(p.Height))
+	}
+	if p.Quality > 0 {
+		opts = append(opts, "q:"+strconv.Itoa(p.Quality))
+	}
+	if p.Format != "" {
+		opts = append(opts, "format:"+p.Format)
+	}
+	return strings.Join(opts, "/")
+}
+
+// Preset returns the operation and options of p, e.g. "resize/w:800/q:80"
+func (p Params) Preset() string {
+	return path.Join(p.Op, p.Options())
+}
+
+// URLPath returns the canonical request path for p
+func (p Params) URLPath() string {
+	return path.Join("/", p.Preset(), p.Path)
+}
@@ -0,0 +1,399 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	stdimage "image"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hiroki-abe-58/imgai/pkg/batch"
+	"github.com/hiroki-abe-58/imgai/pkg/cache"
+	"github.com/hiroki-abe-58/imgai/pkg/image"
+)
+
+// DefaultMaxAge is the Cache-Control max-age used when none is configured
+const DefaultMaxAge = 24 * time.Hour
+
+// DefaultMaxOutputPixels bounds the images a request can ask for when no
+// bound is configured: 40 megapixels, about 160MB decoded
+const DefaultMaxOutputPixels = 40_000_000
+
+// DefaultLimits are the source limits suggested for a server, which unlike
+// a batch run decodes whatever its clients point it at
+var DefaultLimits = image.Limits{
+	MaxPixels:   50_000_000,
+	MaxFileSize: 50 << 20,
+}
+
+// ErrOutputTooLarge is returned when the requested output dimensions exceed
+// the configured maximum
+var ErrOutputTooLarge = errors.New("requested output exceeds resource limits")
+
+// Config configures a Server
+type Config struct {
+	// Root is the directory source images are read from
+	Root string
+
+	// Batch supplies the processing limits shared with batch runs:
+	// Workers bounds the images processed at once and Timeout bounds
+	// the time spent on each
+	Batch *batch.Config
+
+	// Limits bounds the source images that will be decoded
+	Limits image.Limits
+
+	// MaxOutputPixels bounds the pixels of resized images, so a small
+	// source cannot be blown up to any size (0 means DefaultMaxOutputPixels)
+	MaxOutputPixels int64
+
+	// MaxAge is advertised in Cache-Control for processed images
+	MaxAge time.Duration
+
+	// Key, if set, requires every request path to carry a valid
+	// signature made with Sign, so the server cannot be used as an open
+	// resizing proxy
+	Key []byte
+
+	// Presets, if set, lists the only operation and option combinations
+	// that are served, in the form accepted by ParsePreset
+	Presets []Params
+
+	// Cache, if set, keeps encoded responses on disk keyed by the source
+	// content and the canonical options, so repeated requests skip decoding
+	Cache *cache.Store
+}
+
+// Server processes images on the fly from paths such as
+// /resize/w:800/q:80/format:png/photos/cat.jpg
+type Server struct {
+	config  Config
+	root    string
+	presets map[string]bool
+	slots   chan struct{}
+
+	// hashes memoizes source content hashes by path, size and mtime
+	mu     sync.Mutex
+	hashes map[string]sourceHash
+}
+
+// sourceHash is the content hash of a source file in a given state
+type sourceHash struct {
+	size    int64
+	modTime time.Time
+	hash    string
+}
+
+// New creates a Server for config. The root is resolved once so that
+// symbolic links pointing outside of it can be refused.
+func New(config Config) (*Server, error) {
+	if config.Batch == nil {
+		config.Batch = batch.DefaultConfig()
+	}
+	if config.MaxAge <= 0 {
+		config.MaxAge = DefaultMaxAge
+	}
+	if config.MaxOutputPixels <= 0 {
+		config.MaxOutputPixels = DefaultMaxOutputPixels
+	}
+	workers := config.Batch.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	root, err := filepath.Abs(config.Root)
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var presets map[string]bool
+	if len(config.Presets) > 0 {
+		presets = make(map[string]bool, len(config.Presets))
+		for _, preset := range config.Presets {
+			presets[preset.Preset()] = true
+		}
+	}
+
+	return &Server{
+		config:  config,
+		root:    root,
+		presets: presets,
+		slots:   make(chan struct{}, workers),
+		hashes:  make(map[string]sourceHash),
+	}, nil
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var params Params
+	var err error
+	if s.config.Key != nil {
+		params, err = parseSigned(s.config.Key, r.URL.Path)
+	} else {
+		params, err = ParseParams(r.URL.Path)
+	}
+	switch {
+	case errors.Is(err, ErrBadSignature):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if s.presets != nil && !s.presets[params.Preset()] {
+		http.Error(w, "options are not in the allowed presets", http.StatusForbidden)
+		return
+	}
+	s.serve(w, r, params)
+}
+
+// serve answers a request for already validated params
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, params Params) {
+	file, info, sourceFormat, err := s.openSource(params.Path)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	defer file.Close()
+
+	format := params.Format
+	if format == "" {
+		format = negotiateFormat(r.Header.Get("Accept"), sourceFormat)
+		w.Header().Add("Vary", "Accept")
+	}
+
+	etag := entityTag(params, format, info)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(s.config.MaxAge.Seconds())))
+	w.Header().Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	body, err := s.cached(r.Context(), file, info, params, format)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypes[format])
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write(body)
+}
+
+// openSource opens the source image at rel below the root and sniffs its
+// format from the header
+func (s *Server) openSource(rel string) (*os.File, os.FileInfo, string, error) {
+	name, err := s.resolve(rel)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, "", err
+	}
+	if !info.Mode().IsRegular() {
+		file.Close()
+		return nil, nil, "", fs.ErrNotExist
+	}
+	if err := s.config.Limits.CheckFileSize(rel, info.Size()); err != nil {
+		file.Close()
+		return nil, nil, "", err
+	}
+
+	_, format, err := stdimage.DecodeConfig(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, "", fmt.Errorf("%w: %w", image.ErrDecodeImage, err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return nil, nil, "", err
+	}
+	return file, info, image.NormalizeFormat(format), nil
+}
+
+// resolve maps rel to a file below the root. Paths that leave the root,
+// directly or through symbolic links, are reported as not found.
+func (s *Server) resolve(rel string) (string, error) {
+	// Cleaning an absolute path drops any ".." that would leave the root
+	name := filepath.Join(s.root, filepath.FromSlash(path.Clean("/"+rel)))
+
+	resolved, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return "", err
+	}
+	if inside, err := filepath.Rel(s.root, resolved); err != nil || inside == ".." || strings.HasPrefix(inside, ".."+string(filepath.Separator)) {
+		return "", fs.ErrNotExist
+	}
+	return resolved, nil
+}
+
+// cached returns the encoded response from the cache if present, and
+// otherwise processes the source and stores the result
+func (s *Server) cached(ctx context.Context, file *os.File, info os.FileInfo, params Params, format string) ([]byte, error) {
+	if s.config.Cache == nil {
+		return s.process(ctx, file, params, format)
+	}
+
+	key, err := s.variantKey(file, info, params, format)
+	if err != nil {
+		return nil, err
+	}
+	if body, ok := s.config.Cache.GetVariant(key); ok {
+		return body, nil
+	}
+
+	body, err := s.process(ctx, file, params, format)
+	if err != nil {
+		return nil, err
+	}
+	// A response that cannot be cached is still served
+	s.config.Cache.PutVariant(key, body)
+	return body, nil
+}
+
+// variantKey derives the cache key of a response from the source content
+// and the canonical options, leaving file positioned at its start
+func (s *Server) variantKey(file *os.File, info os.FileInfo, params Params, format string) (string, error) {
+	s.mu.Lock()
+	known, ok := s.hashes[file.Name()]
+	s.mu.Unlock()
+
+	hash := known.hash
+	if !ok || known.size != info.Size() || !known.modTime.Equal(info.ModTime()) {
+		h := sha256.New()
+		if _, err := io.Copy(h, file); err != nil {
+			return "", err
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+		hash = hex.EncodeToString(h.Sum(nil))
+
+		s.mu.Lock()
+		s.hashes[file.Name()] = sourceHash{size: info.Size(), modTime: info.ModTime(), hash: hash}
+		s.mu.Unlock()
+	}
+	return cache.VariantKey(hash, "serve", []string{params.Preset(), format})
+}
+
+// process decodes, transforms and encodes the source within a worker slot
+// and the per-image timeout
+func (s *Server) process(ctx context.Context, r io.Reader, params Params, format string) ([]byte, error) {
+	if timeout := s.config.Batch.Timeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	img, _, err := image.Decode(r, s.config.Limits)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	output := img
+	if params.Op == OpResize {
+		opts := image.ResizeOptions{Width: params.Width, Height: params.Height}
+		bounds := img.Bounds()
+		width, height := image.ResizedSize(bounds.Dx(), bounds.Dy(), opts)
+		if pixels := int64(width) * int64(height); pixels > s.config.MaxOutputPixels {
+			return nil, fmt.Errorf("%w: %dx%d is %d pixels (max %d)", ErrOutputTooLarge, width, height, pixels, s.config.MaxOutputPixels)
+		}
+		output = image.Resize(img, opts)
+	}
+
+	quality := params.Quality
+	if quality == 0 {
+		quality = image.DefaultQuality
+	}
+	var buf bytes.Buffer
+	if err := image.Encode(&buf, output, format, quality); err != nil {
+		return nil, fmt.Errorf("%w: %w", image.ErrEncodeImage, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fail writes an error response with a status matching err
+func (s *Server) fail(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	message := http.StatusText(status)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		status, message = http.StatusNotFound, "image not found"
+	case errors.Is(err, ErrOutputTooLarge):
+		status, message = http.StatusRequestEntityTooLarge, err.Error()
+	case errors.Is(err, image.ErrLimitExceeded):
+		status, message = http.StatusRequestEntityTooLarge, "source image exceeds resource limits"
+	case errors.Is(err, image.ErrDecodeImage):
+		status, message = http.StatusUnsupportedMediaType, "source is not a supported image"
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		status, message = http.StatusServiceUnavailable, "processing timed out"
+	}
+	http.Error(w, message, status)
+}
+
+// entityTag derives a strong ETag from the canonical options, the output
+// format and the source file's size and modification time
+func entityTag(params Params, format string, info os.FileInfo) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%d\x00%d", params.URLPath(), format, info.Size(), info.ModTime().UnixNano())
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// etagMatches returns true if an If-None-Match header matches etag
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
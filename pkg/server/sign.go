@@ -0,0 +1,48 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// ErrBadSignature is returned for requests whose signature does not match
+var ErrBadSignature = errors.New("invalid or missing signature")
+
+// Sign returns the URL-safe signature of p: an HMAC-SHA256 over its
+// canonical operation, options and source path
+func Sign(key []byte, p Params) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(p.URLPath()))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignedPath returns the canonical request path for p prefixed with its
+// signature, e.g. /<signature>/resize/w:800/photos/cat.jpg
+func SignedPath(key []byte, p Params) string {
+	return "/" + Sign(key, p) + p.URLPath()
+}
+
+// parseSigned parses a signed request path and verifies its signature
+func parseSigned(key []byte, urlPath string) (Params, error) {
+	signature, rest, ok := strings.Cut(strings.TrimPrefix(urlPath, "/"), "/")
+	if !ok {
+		return Params{}, ErrBadSignature
+	}
+	got, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || len(got) != sha256.Size {
+		return Params{}, ErrBadSignature
+	}
+
+	p, err := ParseParams("/" + rest)
+	if err != nil {
+		return Params{}, err
+	}
+	want, _ := base64.RawURLEncoding.DecodeString(Sign(key, p))
+	if !hmac.Equal(got, want) {
+		return Params{}, ErrBadSignature
+	}
+	return p, nil
+}
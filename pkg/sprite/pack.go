@@ -0,0 +1,134 @@
+package sprite
+
+import (
+	"image"
+	"sort"
+)
+
+// node is a rectangle of the packing tree. Used nodes hold a block in their
+// top-left corner and split the rest into the space right of and below it.
+type node struct {
+	x, y, w, h  int
+	used        bool
+	right, down *node
+}
+
+// pack places rectangles of the given sizes without overlap and returns
+// their positions, in the order of sizes, and the size of the area used.
+// It is the growing binary tree packer: larger blocks are placed first and
+// the area grows right or down, whichever keeps it closer to square.
+func pack(sizes []image.Point) ([]image.Point, image.Point) {
+	positions := make([]image.Point, len(sizes))
+	if len(sizes) == 0 {
+		return positions, image.Point{}
+	}
+
+	order := make([]int, len(sizes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return maxSide(sizes[order[a]]) > maxSide(sizes[order[b]])
+	})
+
+	first := sizes[order[0]]
+	p := &packer{root: &node{w: first.X, h: first.Y}}
+	var extent image.Point
+	for _, i := range order {
+		size := sizes[i]
+		fit := p.root.find(size.X, size.Y)
+		if fit != nil {
+			fit.split(size.X, size.Y)
+		} else {
+			fit = p.grow(size.X, size.Y)
+		}
+		positions[i] = image.Pt(fit.x, fit.y)
+		extent.X = max(extent.X, fit.x+size.X)
+		extent.Y = max(extent.Y, fit.y+size.Y)
+	}
+	return positions, extent
+}
+
+// maxSide returns the longer side of size
+func maxSide(size image.Point) int {
+	return max(size.X, size.Y)
+}
+
+// packer grows the packing tree when a block does not fit
+type packer struct {
+	root *node
+}
+
+// find returns a free node of n that can hold a w x h block
+func (n *node) find(w, h int) *node {
+	if n.used {
+		if fit := n.right.find(w, h); fit != nil {
+			return fit
+		}
+		return n.down.find(w, h)
+	}
+	if w <= n.w && h <= n.h {
+		return n
+	}
+	return nil
+}
+
+// split marks n as holding a w x h block and creates the remaining nodes
+func (n *node) split(w, h int) {
+	n.used = true
+	n.down = &node{x: n.x, y: n.y + h, w: n.w, h: n.h - h}
+	n.right = &node{x: n.x + w, y: n.y, w: n.w - w, h: h}
+}
+
+// grow enlarges the area to fit a w x h block and returns the node holding it
+func (p *packer) grow(w, h int) *node {
+	root := p.root
+	canGrowDown := w <= root.w
+	canGrowRight := h <= root.h
+	shouldGrowRight := canGrowRight && root.h >= root.w+w
+	shouldGrowDown := canGrowDown && root.w >= root.h+h
+
+	switch {
+	case shouldGrowRight:
+		p.growRight(w)
+	case shouldGrowDown:
+		p.growDown(h)
+	case canGrowRight:
+		p.growRight(w)
+	case canGrowDown:
+		p.growDown(h)
+	default:
+		// Blocks are sorted largest first, so this only happens for blocks
+		// wider and taller than everything placed so far
+		p.growRight(w)
+		p.growDown(h)
+	}
+
+	fit := p.root.find(w, h)
+	fit.split(w, h)
+	return fit
+}
+
+// growRight widens the area by w
+func (p *packer) growRight(w int) {
+	root := p.root
+	p.root = &node{
+		used:  true,
+		w:     root.w + w,
+		h:     root.h,
+		down:  root,
+		right: &node{x: root.w, w: w, h: root.h},
+	}
+}
+
+// growDown heightens the area by h
+func (p *packer) growDown(h int) {
+	root := p.root
+	p.root = &node{
+		used:  true,
+		w:     root.w,
+		h:     root.h + h,
+		down:  &node{y: root.h, w: root.w, h: h},
+		right: root,
+	}
+}
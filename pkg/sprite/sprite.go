@@ -0,0 +1,206 @@
+// Package sprite packs images into a single atlas and describes where each
+// one was placed, for CSS sprites and other texture atlases
+package sprite
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	stdimage "image"
+	"image/draw"
+	"io"
+	"path"
+	"strings"
+	"unicode"
+
+	"github.com/disintegration/imaging"
+	"github.com/hiroki-abe-58/imgai/pkg/image"
+)
+
+// MaxSize is the largest width or height of a sheet, the largest contact
+// sheet imgai writes
+const MaxSize = image.MaxSheetSize
+
+var (
+	// ErrDuplicateName is returned when two images map to the same sprite
+	// name
+	ErrDuplicateName = errors.New("duplicate sprite name")
+
+	// ErrTooLarge is returned when the sprites do not fit in a sheet of
+	// MaxSize pixels
+	ErrTooLarge = errors.New("sprite sheet too large")
+)
+
+// Sprite is an image placed on a Sheet
+type Sprite struct {
+	Name   string `json:"-"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+
+	image stdimage.Image
+}
+
+// Sheet is a packed atlas of sprites
+type Sheet struct {
+	Width   int
+	Height  int
+	Sprites []Sprite
+
+	// scale is the pixel ratio of the sheet relative to the coordinates
+	scale int
+}
+
+// Input is an image to pack under a name
+type Input struct {
+	Name  string
+	Image stdimage.Image
+}
+
+// Name returns a CSS-friendly sprite name for the file at path: its base
+// name without extension, lowercased, with other characters replaced by "-"
+func Name(filePath string) string {
+	base := path.Base(strings.ReplaceAll(filePath, `\`, "/"))
+	base = strings.TrimSuffix(base, path.Ext(base))
+
+	var b strings.Builder
+	for _, r := range strings.ToLower(base) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('-')
+		}
+	}
+	return b.String()
+}
+
+// Pack lays out inputs with padding pixels between them and returns the
+// sheet, failing with ErrTooLarge if it exceeds MaxSize. Sprites keep the
+// order of inputs.
+func Pack(inputs []Input, padding int) (*Sheet, error) {
+	seen := make(map[string]bool)
+	sizes := make([]stdimage.Point, len(inputs))
+	for i, input := range inputs {
+		if seen[input.Name] {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateName, input.Name)
+		}
+		seen[input.Name] = true
+		size := input.Image.Bounds().Size()
+		sizes[i] = stdimage.Pt(size.X+padding, size.Y+padding)
+	}
+
+	positions, _ := pack(sizes)
+	sheet := &Sheet{Sprites: make([]Sprite, len(inputs)), scale: 1}
+	for i, input := range inputs {
+		size := input.Image.Bounds().Size()
+		sheet.Sprites[i] = Sprite{
+			Name:   input.Name,
+			X:      positions[i].X,
+			Y:      positions[i].Y,
+			Width:  size.X,
+			Height: size.Y,
+			image:  input.Image,
+		}
+		sheet.Width = max(sheet.Width, positions[i].X+size.X)
+		sheet.Height = max(sheet.Height, positions[i].Y+size.Y)
+	}
+	if err := sheet.checkSize(); err != nil {
+		return nil, err
+	}
+	return sheet, nil
+}
+
+// PackRetina packs inputs given at twice the display resolution. It returns
+// the 1x sheet, with sprites scaled down to half size, and the @2x sheet
+// using the inputs as they are at the same layout scaled by two. Both
+// sheets share the 1x coordinates in CSS.
+func PackRetina(inputs []Input, padding int) (*Sheet, *Sheet, error) {
+	halves := make([]Input, len(inputs))
+	for i, input := range inputs {
+		size := input.Image.Bounds().Size()
+		half := image.Resize(input.Image, image.ResizeOptions{
+			Width:  max((size.X+1)/2, 1),
+			Height: max((size.Y+1)/2, 1),
+		})
+		halves[i] = Input{Name: input.Name, Image: half}
+	}
+
+	sheet, err := Pack(halves, padding)
+	if err != nil {
+		return nil, nil, err
+	}
+	retina := &Sheet{Width: sheet.Width * 2, Height: sheet.Height * 2, scale: 2}
+	for i, sprite := range sheet.Sprites {
+		sprite.image = inputs[i].Image
+		retina.Sprites = append(retina.Sprites, sprite)
+	}
+	if err := retina.checkSize(); err != nil {
+		return nil, nil, err
+	}
+	return sheet, retina, nil
+}
+
+// checkSize fails with ErrTooLarge if the sheet exceeds MaxSize
+func (s *Sheet) checkSize() error {
+	if s.Width > MaxSize || s.Height > MaxSize {
+		return fmt.Errorf("%w: %dx%d exceeds %d pixels; split the images into several sheets", ErrTooLarge, s.Width, s.Height, MaxSize)
+	}
+	return nil
+}
+
+// Image draws the sheet on a transparent background
+func (s *Sheet) Image() *stdimage.NRGBA {
+	atlas := imaging.New(s.Width, s.Height, stdimage.Transparent)
+	for _, sprite := range s.Sprites {
+		bounds := sprite.image.Bounds()
+		at := stdimage.Pt(sprite.X*s.scale, sprite.Y*s.scale)
+		draw.Draw(atlas, stdimage.Rectangle{Min: at, Max: at.Add(bounds.Size())}, sprite.image, bounds.Min, draw.Src)
+	}
+	return atlas
+}
+
+// WriteJSON writes a map of sprite names to their 1x coordinates, with the
+// atlas image URL and size
+func (s *Sheet) WriteJSON(w io.Writer, imageURL string) error {
+	sprites := make(map[string]Sprite, len(s.Sprites))
+	for _, sprite := range s.Sprites {
+		sprites[sprite.Name] = sprite
+	}
+	manifest := struct {
+		Image   string            `json:"image"`
+		Width   int               `json:"width"`
+		Height  int               `json:"height"`
+		Sprites map[string]Sprite `json:"sprites"`
+	}{imageURL, s.Width, s.Height, sprites}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(manifest)
+}
+
+// WriteCSS writes a base class for the atlas and a "<class>-<name>" class
+// per sprite. A non-empty retinaURL adds a media query that swaps in the
+// @2x atlas on high density screens.
+func (s *Sheet) WriteCSS(w io.Writer, class, imageURL, retinaURL string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, ".%s {\n  background-image: url(%q);\n  background-repeat: no-repeat;\n  display: inline-block;\n}\n", class, imageURL)
+	for _, sprite := range s.Sprites {
+		fmt.Fprintf(&b, "\n.%s-%s {\n  background-position: %s %s;\n  width: %dpx;\n  height: %dpx;\n}\n",
+			class, sprite.Name, offset(sprite.X), offset(sprite.Y), sprite.Width, sprite.Height)
+	}
+	if retinaURL != "" {
+		fmt.Fprintf(&b, "\n@media (-webkit-min-device-pixel-ratio: 2), (min-resolution: 192dpi) {\n  .%s {\n    background-image: url(%q);\n    background-size: %dpx %dpx;\n  }\n}\n",
+			class, retinaURL, s.Width, s.Height)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// offset formats a background-position offset for a sprite at v
+func offset(v int) string {
+	if v == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("-%dpx", v)
+}
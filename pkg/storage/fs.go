@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// WriteFS is a file system written through Create and Remove, the
+// counterpart of fs.FS for outputs. Like fs.FS, it takes slash-separated
+// names as accepted by fs.ValidPath.
+type WriteFS interface {
+	// Create starts writing name with the given permissions. Nothing is
+	// visible under name until the returned Writer is committed.
+	Create(name string, perm fs.FileMode) (Writer, error)
+
+	// Remove deletes the named file
+	Remove(name string) error
+}
+
+// Writer is a file being written by WriteFS.Create
+type Writer interface {
+	io.Writer
+
+	// Commit finishes the file and atomically replaces name with it
+	Commit() error
+
+	// Abort discards the file, leaving any existing file at name intact
+	Abort() error
+}
+
+// OpenFile opens name on fsys, or the local file at the native path name
+// when fsys is nil
+func OpenFile(fsys fs.FS, name string) (fs.File, error) {
+	if fsys == nil {
+		return os.Open(name)
+	}
+	return fsys.Open(name)
+}
+
+// StatFile returns the FileInfo of name on fsys, or of the local file at
+// the native path name when fsys is nil
+func StatFile(fsys fs.FS, name string) (fs.FileInfo, error) {
+	if fsys == nil {
+		return os.Stat(name)
+	}
+	return fs.Stat(fsys, name)
+}
+
+// CreateFile starts writing name on fsys, or the local file at the native
+// path name when fsys is nil
+func CreateFile(fsys WriteFS, name string, perm fs.FileMode) (Writer, error) {
+	if fsys == nil {
+		return createLocal(name, perm)
+	}
+	return fsys.Create(name, perm)
+}
+
+// Dir is the local directory tree rooted at the directory it names. Like
+// os.DirFS it is read through io/fs with slash-separated names, and it is
+// written through WriteFS.
+type Dir string
+
+// Open implements fs.FS
+func (d Dir) Open(name string) (fs.File, error) {
+	path, err := d.join("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// Stat implements fs.StatFS
+func (d Dir) Stat(name string) (fs.FileInfo, error) {
+	path, err := d.join("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(path)
+}
+
+// Create implements WriteFS by writing a temporary file in the same
+// directory that is renamed over name on Commit
+func (d Dir) Create(name string, perm fs.FileMode) (Writer, error) {
+	path, err := d.join("create", name)
+	if err != nil {
+		return nil, err
+	}
+	return createLocal(path, perm)
+}
+
+// Remove implements WriteFS
+func (d Dir) Remove(name string) error {
+	path, err := d.join("remove", name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// join returns the native path of name below d, rejecting names that are
+// not valid io/fs names
+func (d Dir) join(op, name string) (string, error) {
+	if !fs.ValidPath(name) || runtime.GOOS == "windows" && strings.ContainsAny(name, `\:`) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(string(d), filepath.FromSlash(name)), nil
+}
+
+// createLocal starts writing the local file at path through a temporary
+// file in the same directory
+func createLocal(path string, perm fs.FileMode) (Writer, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".imgai-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &osWriter{File: tmp, name: path, perm: perm}, nil
+}
+
+// osWriter is a temporary file renamed into place on Commit
+type osWriter struct {
+	*os.File
+	name string
+	perm fs.FileMode
+}
+
+func (w *osWriter) Commit() error {
+	if err := w.File.Close(); err != nil {
+		os.Remove(w.File.Name())
+		return err
+	}
+	if err := os.Chmod(w.File.Name(), w.perm); err != nil {
+		os.Remove(w.File.Name())
+		return err
+	}
+	if err := os.Rename(w.File.Name(), w.name); err != nil {
+		os.Remove(w.File.Name())
+		return err
+	}
+	return nil
+}
+
+func (w *osWriter) Abort() error {
+	w.File.Close()
+	return os.Remove(w.File.Name())
+}
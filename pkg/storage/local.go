@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Local is the Backend for paths on the local file system. It writes
+// through CreateFile, so outputs replace files atomically on either layer.
+type Local struct{}
+
+// Glob implements Backend using filepath.Glob
+func (Local) Glob(ctx context.Context, pattern string) ([]string, error) {
+	return filepath.Glob(pattern)
+}
+
+// Open implements Backend
+func (Local) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+// WriteFile implements Backend, creating parent directories as needed and
+// replacing the file atomically
+func (Local) WriteFile(ctx context.Context, name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	w, err := CreateFile(nil, name, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Abort()
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Commit()
+}
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"bytes"
+	"io/fs"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemFS is an in-memory file system of regular files, for tests and for
+// staging files that never touch the disk. It is read through io/fs and
+// written through WriteFS, with names as accepted by fs.ValidPath.
+type MemFS struct {
+	mu    sync.RWMutex
+	files map[string]*memFile
+}
+
+// memFile is the content and metadata of a MemFS file
+type memFile struct {
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// NewMemFS returns an empty MemFS
+func NewMemFS() *MemFS {
+	return &MemFS{files: make(map[string]*memFile)}
+}
+
+// WriteFile stores data under name, replacing any existing file
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[name] = &memFile{data: bytes.Clone(data), mode: perm, modTime: time.Now()}
+	return nil
+}
+
+// ReadFile implements fs.ReadFileFS
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	file, err := m.file("read", name)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Clone(file.data), nil
+}
+
+// Open implements fs.FS
+func (m *MemFS) Open(name string) (fs.File, error) {
+	file, err := m.file("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return &memReader{Reader: bytes.NewReader(file.data), info: file.info(name)}, nil
+}
+
+// Stat implements fs.StatFS
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	file, err := m.file("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return file.info(name), nil
+}
+
+// file returns the file stored under name for op
+func (m *MemFS) file(op, name string) (*memFile, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	file, ok := m.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return file, nil
+}
+
+// Glob implements fs.GlobFS with path.Match, returning names in lexical order
+func (m *MemFS) Glob(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var matches []string
+	for name := range m.files {
+		if ok, _ := path.Match(pattern, name); ok {
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// Create implements WriteFS
+func (m *MemFS) Create(name string, perm fs.FileMode) (Writer, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrInvalid}
+	}
+	return &memWriter{fsys: m, name: name, perm: perm}, nil
+}
+
+// Remove implements WriteFS
+func (m *MemFS) Remove(name string) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+// info returns the FileInfo of the file stored under name
+func (f *memFile) info(name string) fs.FileInfo {
+	return memInfo{name: path.Base(name), size: int64(len(f.data)), mode: f.mode, modTime: f.modTime}
+}
+
+// memReader is an open MemFS file
+type memReader struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+func (r *memReader) Stat() (fs.FileInfo, error) { return r.info, nil }
+func (r *memReader) Close() error               { return nil }
+
+// memWriter buffers a MemFS file until it is committed
+type memWriter struct {
+	bytes.Buffer
+	fsys *MemFS
+	name string
+	perm fs.FileMode
+}
+
+func (w *memWriter) Commit() error {
+	return w.fsys.WriteFile(w.name, w.Bytes(), w.perm)
+}
+
+func (w *memWriter) Abort() error {
+	w.Reset()
+	return nil
+}
+
+// memInfo implements fs.FileInfo for MemFS files
+type memInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return i.size }
+func (i memInfo) Mode() fs.FileMode  { return i.mode }
+func (i memInfo) ModTime() time.Time { return i.modTime }
+func (i memInfo) IsDir() bool        { return false }
+func (i memInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,296 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/hiroki-abe-58/imgai/pkg/storage"
+)
+
+// Scheme is the URL scheme of S3 object names, as in s3://bucket/key
+const Scheme = "s3"
+
+// DefaultRegion is used when no region is configured
+const DefaultRegion = "us-east-1"
+
+// DefaultTimeout bounds a single request when no client is configured
+const DefaultTimeout = 60 * time.Second
+
+// ErrRequest indicates that the object store rejected a request
+var ErrRequest = errors.New("s3 request failed")
+
+// Config configures a Client
+type Config struct {
+	// Endpoint is the base URL of an S3-compatible service such as MinIO,
+	// e.g. http://localhost:9000. Empty means AWS S3 in Region.
+	Endpoint string
+
+	// Region is the signing region (default DefaultRegion)
+	Region string
+
+	// AccessKey, SecretKey and SessionToken are the credentials. Requests
+	// are sent unsigned when AccessKey is empty, for public buckets.
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+
+	// PathStyle addresses buckets as endpoint/bucket instead of
+	// bucket.endpoint; it is implied by a custom Endpoint
+	PathStyle bool
+
+	// Client performs the requests; nil uses a client with Timeout. Tests
+	// can point Endpoint at an in-process fake and supply its client here.
+	Client *http.Client
+
+	// Timeout bounds each request including its body when Client is nil
+	// (0 means DefaultTimeout)
+	Timeout time.Duration
+}
+
+// ConfigFromEnv reads the configuration from the standard AWS environment
+// variables
+func ConfigFromEnv() Config {
+	return Config{
+		Endpoint:     firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"),
+		Region:       firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// firstEnv returns the first non-empty environment variable of names
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// Client is a minimal S3 client implementing storage.Backend for
+// s3://bucket/key names
+type Client struct {
+	config Config
+	now    func() time.Time
+}
+
+// New creates a Client for config
+func New(config Config) *Client {
+	if config.Region == "" {
+		config.Region = DefaultRegion
+	}
+	if config.Endpoint != "" {
+		config.PathStyle = true
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: config.Timeout}
+	}
+	return &Client{config: config, now: time.Now}
+}
+
+// ParseURL splits an s3://bucket/key name into bucket and key
+func ParseURL(name string) (bucket, key string, err error) {
+	rest, ok := strings.CutPrefix(name, Scheme+"://")
+	if !ok {
+		return "", "", fmt.Errorf("not an s3:// URL: %s", name)
+	}
+	bucket, key, _ = strings.Cut(rest, "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("missing bucket in %s", name)
+	}
+	return bucket, key, nil
+}
+
+// Glob implements storage.Backend. The key pattern uses path.Match syntax,
+// so * does not match /; objects are listed from the longest literal prefix.
+func (c *Client) Glob(ctx context.Context, pattern string) ([]string, error) {
+	bucket, keyPattern, err := ParseURL(pattern)
+	if err != nil {
+		return nil, err
+	}
+	meta := strings.IndexAny(keyPattern, `*?[\`)
+	if meta < 0 {
+		return []string{pattern}, nil
+	}
+	if _, err := path.Match(keyPattern, ""); err != nil {
+		return nil, err
+	}
+
+	keys, err := c.list(ctx, bucket, keyPattern[:meta])
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, key := range keys {
+		if ok, _ := path.Match(keyPattern, key); ok {
+			matches = append(matches, Scheme+"://"+bucket+"/"+key)
+		}
+	}
+	return matches, nil
+}
+
+// Open implements storage.Backend
+func (c *Client) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	bucket, key, err := ParseURL(name)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(ctx, http.MethodGet, bucket, key, nil, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return resp.Body, nil
+}
+
+// WriteFile implements storage.Backend, uploading data with a content type
+// derived from the key's extension
+func (c *Client) WriteFile(ctx context.Context, name string, data []byte) error {
+	bucket, key, err := ParseURL(name)
+	if err != nil {
+		return err
+	}
+	if key == "" || strings.HasSuffix(key, "/") {
+		return fmt.Errorf("missing object key in %s", name)
+	}
+	contentType := mime.TypeByExtension(path.Ext(key))
+	resp, err := c.do(ctx, http.MethodPut, bucket, key, nil, data, contentType)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// listResult is the body of a ListObjectsV2 response
+type listResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// list returns the keys in bucket starting with prefix
+func (c *Client) list(ctx context.Context, bucket, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := c.do(ctx, http.MethodGet, bucket, "", query, nil, "")
+		if err != nil {
+			return nil, fmt.Errorf("s3://%s/%s: %w", bucket, prefix, err)
+		}
+		var result listResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid list response: %w", ErrRequest, err)
+		}
+
+		for _, object := range result.Contents {
+			keys = append(keys, object.Key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// errorResponse is the body of an S3 error response
+type errorResponse struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// do sends a signed request for key in bucket and returns the response if
+// it succeeded. Missing objects are reported as fs.ErrNotExist and
+// throttling or server errors as storage.ErrUnavailable.
+func (c *Client) do(ctx context.Context, method, bucket, key string, query url.Values, body []byte, contentType string) (*http.Response, error) {
+	u, err := c.objectURL(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.URL.RawPath = escapePath(req.URL.Path)
+	req.ContentLength = int64(len(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.config.AccessKey != "" {
+		payloadHash := emptyHash
+		if len(body) > 0 {
+			payloadHash = hexSHA256(body)
+		}
+		c.sign(req, payloadHash, c.now())
+	}
+
+	resp, err := c.config.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	var apiErr errorResponse
+	xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&apiErr)
+	if apiErr.Code == "" {
+		apiErr.Code = resp.Status
+	}
+	err = fmt.Errorf("%w: %s %s", ErrRequest, apiErr.Code, apiErr.Message)
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		err = fmt.Errorf("%w: %w", fs.ErrNotExist, err)
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		err = fmt.Errorf("%w: %w", storage.ErrUnavailable, err)
+	}
+	return nil, err
+}
+
+// objectURL returns the URL of key in bucket for the configured addressing
+func (c *Client) objectURL(bucket, key string) (*url.URL, error) {
+	endpoint := c.config.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + c.config.Region + ".amazonaws.com"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint: %s", endpoint)
+	}
+
+	base := strings.TrimSuffix(u.Path, "/")
+	if c.config.PathStyle {
+		u.Path = base + "/" + bucket + "/" + key
+	} else {
+		u.Host = bucket + "." + u.Host
+		u.Path = base + "/" + key
+	}
+	return u, nil
+}
@@ -0,0 +1,131 @@
+// Package storage gives imgai two views of where images live.
+//
+// Backend addresses whole files by name across local paths and remote
+// schemes such as s3://. It is how the CLI expands input patterns, copies
+// remote inputs to a local staging directory and publishes finished
+// outputs, so remote stores only ever see complete files.
+//
+// Processing reads through fs.FS and writes through WriteFS: decoding and
+// encoding, archive members, the batch journal and the cache. Names on
+// both follow fs.ValidPath, so os.DirFS, embed.FS or fstest.MapFS can
+// serve inputs and Dir or MemFS can take outputs. A nil file system stands
+// for the local one reached with native paths, which only OpenFile,
+// StatFile and CreateFile translate. Remote files are staged locally
+// before they are processed, and Local, the Backend for local paths,
+// writes through CreateFile.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Backend reads and writes files addressed by name. Local paths use the
+// file system; names of the form scheme://... use the backend registered
+// for the scheme.
+type Backend interface {
+	// Glob returns the names matching pattern, in lexical order
+	Glob(ctx context.Context, pattern string) ([]string, error)
+
+	// Open opens the named file for reading
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+
+	// WriteFile replaces the named file with data
+	WriteFile(ctx context.Context, name string, data []byte) error
+}
+
+// ErrUnavailable indicates a temporary failure of a remote server (e.g. HTTP
+// 429 or 5xx) worth retrying
+var ErrUnavailable = errors.New("server temporarily unavailable")
+
+var (
+	mu       sync.RWMutex
+	backends = make(map[string]Backend)
+)
+
+// Register makes backend handle names with the given scheme, e.g. "s3"
+func Register(scheme string, backend Backend) {
+	mu.Lock()
+	defer mu.Unlock()
+	backends[strings.ToLower(scheme)] = backend
+}
+
+// Scheme returns the lowercased scheme of name, or "" for local paths
+func Scheme(name string) string {
+	i := strings.Index(name, "://")
+	if i <= 0 || strings.ContainsAny(name[:i], `/\`) {
+		return ""
+	}
+	return strings.ToLower(name[:i])
+}
+
+// IsRemote returns true if name has a scheme rather than being a local path
+func IsRemote(name string) bool {
+	return Scheme(name) != ""
+}
+
+// For returns the backend handling name
+func For(name string) (Backend, error) {
+	scheme := Scheme(name)
+	if scheme == "" {
+		return Local{}, nil
+	}
+
+	mu.RLock()
+	backend, ok := backends[scheme]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported storage scheme: %s://", scheme)
+	}
+	return backend, nil
+}
+
+// Glob returns the names matching pattern on its backend
+func Glob(ctx context.Context, pattern string) ([]string, error) {
+	backend, err := For(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return backend.Glob(ctx, pattern)
+}
+
+// Open opens name on its backend
+func Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	backend, err := For(name)
+	if err != nil {
+		return nil, err
+	}
+	return backend.Open(ctx, name)
+}
+
+// WriteFile writes name on its backend
+func WriteFile(ctx context.Context, name string, data []byte) error {
+	backend, err := For(name)
+	if err != nil {
+		return err
+	}
+	return backend.WriteFile(ctx, name, data)
+}
+
+// Join joins a directory name and a file name, keeping the "/" separator
+// for remote names
+func Join(dir, name string) string {
+	if !IsRemote(dir) {
+		return filepath.Join(dir, name)
+	}
+	return strings.TrimSuffix(dir, "/") + "/" + path.Clean("/" + name)[1:]
+}
+
+// Base returns the last element of name
+func Base(name string) string {
+	if !IsRemote(name) {
+		return filepath.Base(name)
+	}
+	return path.Base(name)
+}
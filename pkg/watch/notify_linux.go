@@ -0,0 +1,174 @@
+//go:build linux
+
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// inotifyMask selects events for files that were written or moved into
+// the directory. Modifications are included so long writes keep extending
+// the debounce period.
+const inotifyMask = unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_MODIFY
+
+// inotify delivers change notifications from the Linux kernel
+type inotify struct {
+	dir    string
+	file   *os.File
+	events chan string
+	errors chan error
+	done   chan struct{}
+
+	// files is the state of the files as last seen, at the start, in an
+	// event or in a rescan, against which a rescan detects changes
+	files map[string]fileState
+}
+
+// newNotifier watches dir with inotify, falling back to polling when
+// inotify is unavailable (e.g. the watch limit is exhausted)
+func newNotifier(dir string, interval time.Duration) (notifier, error) {
+	n, err := newInotify(dir)
+	if err != nil {
+		if _, statErr := os.Stat(dir); statErr != nil {
+			return nil, statErr
+		}
+		return newPoller(dir, interval)
+	}
+	return n, nil
+}
+
+// newInotify starts an inotify watch on dir
+func newInotify(dir string) (*inotify, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	if _, err := unix.InotifyAddWatch(fd, dir, inotifyMask|unix.IN_ONLYDIR); err != nil {
+		unix.Close(fd)
+		return nil, os.NewSyscallError("inotify_add_watch", err)
+	}
+	// Files present before the watch only count as changed once they differ
+	files, err := scan(dir)
+	if err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	// A non-blocking descriptor is served by the runtime poller, so Close
+	// interrupts a pending Read
+	n := &inotify{
+		dir:    dir,
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		events: make(chan string),
+		errors: make(chan error, 1),
+		done:   make(chan struct{}),
+		files:  files,
+	}
+	go n.loop()
+	return n, nil
+}
+
+// Events returns the channel of changed paths
+func (n *inotify) Events() <-chan string {
+	return n.events
+}
+
+// Errors returns the channel of read errors
+func (n *inotify) Errors() <-chan error {
+	return n.errors
+}
+
+// Close stops the watch
+func (n *inotify) Close() error {
+	close(n.done)
+	return n.file.Close()
+}
+
+// loop reads and decodes events until the descriptor is closed
+func (n *inotify) loop() {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		size, err := n.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				n.errors <- err
+			}
+			return
+		}
+
+		for offset := 0; offset+unix.SizeofInotifyEvent <= size; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			offset = nameStart + int(event.Len)
+
+			if event.Mask&unix.IN_Q_OVERFLOW != 0 {
+				// The kernel dropped events: report what may have changed
+				if err := n.rescan(); err != nil {
+					n.errors <- err
+					return
+				}
+				continue
+			}
+			if event.Mask&unix.IN_IGNORED != 0 {
+				n.errors <- errors.New("watched directory was removed")
+				return
+			}
+			if event.Mask&unix.IN_ISDIR != 0 || event.Len == 0 {
+				continue
+			}
+
+			name := buf[nameStart:offset]
+			// Names are NUL-padded to the event length
+			for len(name) > 0 && name[len(name)-1] == 0 {
+				name = name[:len(name)-1]
+			}
+
+			path := filepath.Join(n.dir, string(name))
+			n.see(path)
+			select {
+			case n.events <- path:
+			case <-n.done:
+				return
+			}
+		}
+	}
+}
+
+// see records the current state of path for rescans
+func (n *inotify) see(path string) {
+	if info, err := os.Stat(path); err == nil {
+		n.files[path] = stateOf(info)
+	} else {
+		delete(n.files, path)
+	}
+}
+
+// rescan reports the files that are new or differ in size or modification
+// time from when they were last seen, as events for some of them may have
+// been lost. Unlike a modification time cutoff, this also catches files
+// moved or copied in with an old modification time.
+func (n *inotify) rescan() error {
+	files, err := scan(n.dir)
+	if err != nil {
+		return fmt.Errorf("failed to rescan after event queue overflow: %w", err)
+	}
+	for path, state := range files {
+		if old, ok := n.files[path]; ok && old == state {
+			continue
+		}
+		select {
+		case n.events <- path:
+		case <-n.done:
+			return nil
+		}
+	}
+	n.files = files
+	return nil
+}
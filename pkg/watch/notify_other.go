@@ -0,0 +1,11 @@
+//go:build !linux
+
+package watch
+
+import "time"
+
+// newNotifier falls back to polling where native notifications are not
+// implemented
+func newNotifier(dir string, interval time.Duration) (notifier, error) {
+	return newPoller(dir, interval)
+}
@@ -0,0 +1,117 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// fileState is the part of a file's metadata used to detect changes
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// stateOf returns the fileState of info
+func stateOf(info os.FileInfo) fileState {
+	return fileState{size: info.Size(), modTime: info.ModTime()}
+}
+
+// poller detects changes by scanning a directory at a fixed interval
+type poller struct {
+	dir    string
+	events chan string
+	errors chan error
+	done   chan struct{}
+	files  map[string]fileState
+}
+
+// newPoller starts polling dir every interval. Files present when it starts
+// are not reported unless they change later.
+func newPoller(dir string, interval time.Duration) (*poller, error) {
+	p := &poller{
+		dir:    dir,
+		events: make(chan string),
+		errors: make(chan error, 1),
+		done:   make(chan struct{}),
+	}
+	files, err := scan(dir)
+	if err != nil {
+		return nil, err
+	}
+	p.files = files
+
+	go p.loop(interval)
+	return p, nil
+}
+
+// Events returns the channel of changed paths
+func (p *poller) Events() <-chan string {
+	return p.events
+}
+
+// Errors returns the channel of scan errors
+func (p *poller) Errors() <-chan error {
+	return p.errors
+}
+
+// Close stops polling
+func (p *poller) Close() error {
+	close(p.done)
+	return nil
+}
+
+// loop rescans the directory until Close is called
+func (p *poller) loop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+
+		files, err := scan(p.dir)
+		if err != nil {
+			select {
+			case p.errors <- err:
+			default:
+			}
+			return
+		}
+		for path, state := range files {
+			if old, ok := p.files[path]; ok && old == state {
+				continue
+			}
+			select {
+			case p.events <- path:
+			case <-p.done:
+				return
+			}
+		}
+		p.files = files
+	}
+}
+
+// scan returns the state of the regular files directly in dir
+func scan(dir string) (map[string]fileState, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]fileState, len(entries))
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // removed since ReadDir
+		}
+		files[filepath.Join(dir, entry.Name())] = stateOf(info)
+	}
+	return files, nil
+}
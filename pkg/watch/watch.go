@@ -0,0 +1,124 @@
+package watch
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Default timings for Watch
+const (
+	DefaultDebounce     = 500 * time.Millisecond
+	DefaultPollInterval = time.Second
+)
+
+// Options configures Watch
+type Options struct {
+	// Debounce is how long a file must go without changes before it is
+	// handled, so files still being written are not picked up early
+	Debounce time.Duration
+
+	// PollInterval is the scan interval when polling is used
+	PollInterval time.Duration
+
+	// Poll forces polling even where native notifications are available,
+	// e.g. for network shares that do not deliver them
+	Poll bool
+
+	// Filter, if set, reports whether a changed path should be handled
+	Filter func(path string) bool
+}
+
+// notifier delivers the paths of files in a directory that were created
+// or written
+type notifier interface {
+	Events() <-chan string
+	Errors() <-chan error
+	Close() error
+}
+
+// Watch watches dir for files that are created or changed and calls handle
+// with batches of paths once each has been quiet for the debounce period.
+// Calls to handle never overlap; changes seen while it runs are queued for
+// the next call. Watch returns when ctx is done or the watcher fails.
+func Watch(ctx context.Context, dir string, opts Options, handle func(ctx context.Context, files []string)) error {
+	if opts.Debounce <= 0 {
+		opts.Debounce = DefaultDebounce
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+
+	var n notifier
+	var err error
+	if opts.Poll {
+		n, err = newPoller(dir, opts.PollInterval)
+	} else {
+		n, err = newNotifier(dir, opts.PollInterval)
+	}
+	if err != nil {
+		return err
+	}
+	defer n.Close()
+
+	// Check for quiet files a few times per debounce period
+	ticker := time.NewTicker(opts.Debounce / 4)
+	defer ticker.Stop()
+
+	pending := make(map[string]time.Time)
+	var running chan struct{}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if running != nil {
+				<-running
+			}
+			return nil
+
+		case err := <-n.Errors():
+			if running != nil {
+				<-running
+			}
+			return err
+
+		case path := <-n.Events():
+			path = filepath.Clean(path)
+			if opts.Filter == nil || opts.Filter(path) {
+				pending[path] = time.Now()
+			}
+
+		case <-running:
+			running = nil
+
+		case now := <-ticker.C:
+			if running != nil {
+				continue
+			}
+			files := quietFiles(pending, now, opts.Debounce)
+			if len(files) == 0 {
+				continue
+			}
+			running = make(chan struct{})
+			go func(done chan struct{}) {
+				defer close(done)
+				handle(ctx, files)
+			}(running)
+		}
+	}
+}
+
+// quietFiles removes and returns the pending paths whose last change is at
+// least debounce before now, in sorted order
+func quietFiles(pending map[string]time.Time, now time.Time, debounce time.Duration) []string {
+	var files []string
+	for path, changed := range pending {
+		if now.Sub(changed) >= debounce {
+			files = append(files, path)
+			delete(pending, path)
+		}
+	}
+	sort.Strings(files)
+	return files
+}